@@ -0,0 +1,296 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const defaultPort = "7007"
+
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+)
+
+// addressSelected is true when the user restricted the advertised
+// address to a specific interface and/or network
+func addressSelected() bool {
+	return iface != "" || network != ""
+}
+
+// bottlenetURL builds the URL of a bottlenet endpoint on addr, taking
+// care of bracketed IPv6 hosts and zones
+func bottlenetURL(addr, path string) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   addr,
+		Path:   "/" + path,
+	}
+	return u.String()
+}
+
+// listenHostPort splits --address into host and port, falling back
+// to the default port when --address does not carry one
+func listenHostPort() (string, string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// bare host or IPv6 literal without a port
+		return strings.Trim(address, "[]"), defaultPort
+	}
+	if port == "" {
+		port = defaultPort
+	}
+	return host, port
+}
+
+// listenAddr is the address the bottlenet server binds to
+func listenAddr() string {
+	host, port := listenHostPort()
+	// dual-stack nodes must be reachable in both families
+	if host == "" && addressSelected() && !dualStack {
+		ips, err := candidateIPs()
+		if err == nil && len(ips) > 0 {
+			host = ips[0].String()
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return familyIPv4
+	}
+	return familyIPv6
+}
+
+// localIPs returns the IPs used as the source of data traffic, or
+// nothing if the operating system should pick one
+func localIPs() []net.IPAddr {
+	if !addressSelected() {
+		return nil
+	}
+	host, _ := listenHostPort()
+	if ip, err := net.ResolveIPAddr("ip", host); err == nil && host != "" {
+		return []net.IPAddr{*ip}
+	}
+	ips, err := candidateIPs()
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+// dialContext pins the source address to one of the selected local
+// addresses of the same family as the remote. Link-local remotes are
+// advertised without a zone and reached through --interface.
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := newDialer()
+	locals := localIPs()
+	if len(locals) == 0 {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	remote, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	linkLocal := remote.IP.IsLinkLocalUnicast() && remote.IP.To4() == nil
+	if linkLocal && remote.Zone == "" && iface != "" {
+		addr = net.JoinHostPort(remote.IP.String()+"%"+iface, port)
+	}
+	var local *net.IPAddr
+	for i, ip := range locals {
+		if ipFamily(ip.IP) != ipFamily(remote.IP) {
+			continue
+		}
+		if local == nil || (linkLocal && ip.IP.IsLinkLocalUnicast() && !local.IP.IsLinkLocalUnicast()) {
+			local = &locals[i]
+		}
+	}
+	if local != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: local.IP, Zone: local.Zone}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// candidateIPs lists the local IPs that match --interface and --network,
+// ordered by --prefer
+func candidateIPs() ([]net.IPAddr, error) {
+	var ipnet *net.IPNet
+	if network != "" {
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s': %v", network, err)
+		}
+		ipnet = n
+	}
+
+	var inters []net.Interface
+	if iface != "" {
+		inter, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interface '%s': %v", iface, err)
+		}
+		inters = []net.Interface{*inter}
+	} else {
+		var err error
+		if inters, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+
+	ips := []net.IPAddr{}
+	for _, inter := range inters {
+		addrs, err := inter.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ip, _, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				continue
+			}
+			// loopback and link-local addresses are only used when
+			// the interface is explicitly asked for
+			if ip.IsLoopback() && iface == "" {
+				continue
+			}
+			zone := ""
+			if ip.IsLinkLocalUnicast() {
+				if iface == "" {
+					continue
+				}
+				if ip.To4() == nil {
+					zone = inter.Name
+				}
+			}
+			if ipnet != nil && !ipnet.Contains(ip) {
+				continue
+			}
+			ips = append(ips, net.IPAddr{IP: ip, Zone: zone})
+		}
+	}
+
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ipFamily(ips[i].IP) == preferFamily && ipFamily(ips[j].IP) != preferFamily
+	})
+	return ips, nil
+}
+
+func validateAddressSelection() error {
+	if preferFamily != familyIPv4 && preferFamily != familyIPv6 {
+		return fmt.Errorf("invalid --prefer '%s', expected '%s' or '%s'", preferFamily, familyIPv4, familyIPv6)
+	}
+	if !addressSelected() {
+		return nil
+	}
+	ips, err := candidateIPs()
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		switch {
+		case iface != "" && network != "":
+			return fmt.Errorf("interface '%s' has no address in network '%s'", iface, network)
+		case iface != "":
+			return fmt.Errorf("interface '%s' has no usable address", iface)
+		default:
+			return fmt.Errorf("no local address in network '%s'", network)
+		}
+	}
+
+	host, _ := listenHostPort()
+	if host == "" {
+		return nil
+	}
+	ip, err := net.ResolveIPAddr("ip", host)
+	if err != nil || net.ParseIP(strings.Split(host, "%")[0]) == nil {
+		return fmt.Errorf("--address host '%s' must be an IP when --interface or --network is set", host)
+	}
+	for _, x := range ips {
+		if x.IP.Equal(ip.IP) {
+			return nil
+		}
+	}
+	return fmt.Errorf("--address '%s' does not match --interface/--network", address)
+}
+
+// getLocalIPs returns the host:port addresses this node can be reached
+// at, the preferred one first. Zones are left out, as they name an
+// interface of this node only.
+func getLocalIPs() []string {
+	host, port := listenHostPort()
+	if host != "" {
+		return []string{net.JoinHostPort(strings.Split(host, "%")[0], port)}
+	}
+
+	ips, err := candidateIPs()
+	if err != nil {
+		panic(err)
+	}
+
+	toRet := []string{}
+	for _, ip := range ips {
+		toRet = append(toRet, net.JoinHostPort(ip.IP.String(), port))
+	}
+	return toRet
+}
+
+// getAltLocalIP returns the address of this node in the family other
+// than the one advertised, used to test dual-stack pairs in both families
+func getAltLocalIP() string {
+	if !dualStack {
+		return ""
+	}
+	// a pinned --address binds a single family only
+	if host, _ := listenHostPort(); host != "" {
+		return ""
+	}
+	addrs := getLocalIPs()
+	if len(addrs) == 0 {
+		return ""
+	}
+	family := func(addr string) string {
+		host, _, _ := net.SplitHostPort(addr)
+		ip := net.ParseIP(strings.Split(host, "%")[0])
+		if ip == nil {
+			return ""
+		}
+		return ipFamily(ip)
+	}
+
+	primary := family(addrs[0])
+	if primary == "" {
+		return ""
+	}
+	for _, addr := range addrs[1:] {
+		if f := family(addr); f != "" && f != primary {
+			return addr
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/minio/bottlenet/pkg"
+)
+
+// agent serves the bottlenet endpoints without joining a coordinator,
+// waiting for a coordinator started with --peers to push a plan to it
+func agent(ctx context.Context) error {
+	fmt.Printf("bottlenet agent %s listening on %s\n", pkg.Version, getLocalIPs()[0])
+	return serveBottlenet(ctx, nil)
+}
+
+func localNodeType() nodeType {
+	if clientMode {
+		return nodeTypeClient
+	}
+	if serverMode {
+		return nodeTypeServer
+	}
+	return nodeTypePeer
+}
+
+func listenInfo(w http.ResponseWriter, r *http.Request) {
+	respBody, err := json.Marshal(newSelfNode(localNodeType()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(respBody)
+}
+
+func doInfo(ctx context.Context, addr string) (*node, error) {
+	client := newClient()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bottlenetURL(addr, "info"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(string(respBody))
+	}
+
+	n := &node{}
+	if err := json.Unmarshal(respBody, n); err != nil {
+		return nil, err
+	}
+	// the address we reached the agent at is known to work, unlike
+	// the one it would advertise on its own
+	n.Addr = addr
+	return n, nil
+}
+
+// staticPeerAddrs merges --peers and the addresses listed in --peers-file
+func staticPeerAddrs() ([]string, error) {
+	addrs := []string{}
+	for _, p := range staticPeers {
+		if p = strings.TrimSpace(p); p != "" {
+			addrs = append(addrs, p)
+		}
+	}
+	if peersFile != "" {
+		f, err := os.Open(peersFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, p := range strings.Split(line, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					addrs = append(addrs, p)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	// an agent listed in both --peers and --peers-file is tested once
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, addr := range addrs {
+		if err := validateHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid peer '%s': %v", addr, err)
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			unique = append(unique, addr)
+		}
+	}
+	return unique, nil
+}
+
+// addStaticPeers contacts every agent in addrs and admits it to the
+// cluster after checking its version and mode
+func addStaticPeers(ctx context.Context, addrs []string) error {
+	for _, addr := range addrs {
+		n, err := doInfo(ctx, addr)
+		if err != nil {
+			return fmt.Errorf("could not reach peer %s: %v", addr, err)
+		}
+		if err := addPeer(n); err != nil {
+			return fmt.Errorf("could not add peer %s: %v", addr, err)
+		}
+		fmt.Printf("%s peer %s joined\n", infoText(dot), addr)
+	}
+	return nil
+}
@@ -0,0 +1,570 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg/analysis"
+	"github.com/minio/bottlenet/pkg/perf"
+)
+
+// edge is a single directional measurement between two nodes
+type edge struct {
+	Src      string
+	Dst      string
+	Perf     perf.Perf
+	Retested bool
+	// Family is the IP family the edge was measured over, and Alt is
+	// set if it is not the family of the address Dst joined with
+	Family string
+	Alt    bool
+}
+
+// key names the pair of the edge, and its family if it is the alternate
+func (e edge) key() string {
+	if e.Alt {
+		return pairKey(e.Src, e.Dst) + " over " + e.Family
+	}
+	return pairKey(e.Src, e.Dst)
+}
+
+// reportEdges flattens the results of a report into edges, resolving
+// alternate family addresses to the address the node joined with
+func reportEdges(rep report) []edge {
+	canonical := map[string]string{}
+	for addr, n := range rep.Nodes {
+		canonical[addr] = addr
+		if n.AltAddr != "" {
+			canonical[n.AltAddr] = addr
+		}
+	}
+	resolve := func(addr string) string {
+		if c, ok := canonical[addr]; ok {
+			return c
+		}
+		return addr
+	}
+
+	edges := []edge{}
+	for src, remotes := range rep.Results {
+		for _, remote := range remotes {
+			for dst, p := range remote.Perf {
+				family := ""
+				if host, _, err := net.SplitHostPort(dst); err == nil {
+					if ip := net.ParseIP(host); ip != nil {
+						family = ipFamily(ip)
+					}
+				}
+				edges = append(edges, edge{
+					Src:      resolve(src),
+					Dst:      resolve(dst),
+					Perf:     p,
+					Retested: remote.Retested,
+					Family:   family,
+					Alt:      resolve(dst) != dst,
+				})
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Src != edges[j].Src {
+			return edges[i].Src < edges[j].Src
+		}
+		if edges[i].Dst != edges[j].Dst {
+			return edges[i].Dst < edges[j].Dst
+		}
+		return !edges[i].Alt && edges[j].Alt
+	})
+	return edges
+}
+
+// primaryEdges are the edges measured over the family of the address
+// each node joined with. The aggregates count every pair once and do
+// not mix families, which dualStackPairs compares instead.
+func primaryEdges(rep report) []edge {
+	edges := []edge{}
+	for _, e := range reportEdges(rep) {
+		if !e.Alt {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// dualStackPair is the throughput of a pair over both IP families
+type dualStackPair struct {
+	Src           string
+	Dst           string
+	Family        string
+	Throughput    float64
+	AltFamily     string
+	AltThroughput float64
+}
+
+// dualStackPairs lists the pairs measured over both families
+func dualStackPairs(rep report) []dualStackPair {
+	primary := map[string]edge{}
+	for _, e := range primaryEdges(rep) {
+		primary[pairKey(e.Src, e.Dst)] = e
+	}
+	pairs := []dualStackPair{}
+	for _, e := range reportEdges(rep) {
+		p, ok := primary[pairKey(e.Src, e.Dst)]
+		if !e.Alt || !ok {
+			continue
+		}
+		pairs = append(pairs, dualStackPair{
+			Src:           e.Src,
+			Dst:           e.Dst,
+			Family:        p.Family,
+			Throughput:    p.Perf.Throughput.Avg,
+			AltFamily:     e.Family,
+			AltThroughput: e.Perf.Throughput.Avg,
+		})
+	}
+	return pairs
+}
+
+func printDualStack(pairs []dualStackPair) {
+	if len(pairs) == 0 {
+		return
+	}
+	fmt.Println("Dual-stack pairs:")
+	for _, p := range pairs {
+		fmt.Printf("  %s : %s/s over %s, %s/s over %s\n", pairKey(p.Src, p.Dst),
+			humanize.IBytes(uint64(p.Throughput)), p.Family, humanize.IBytes(uint64(p.AltThroughput)), p.AltFamily)
+	}
+}
+
+// pairFailure is a pair that could not be tested
+type pairFailure struct {
+	Src   string
+	Dst   string
+	Error string
+}
+
+// reportFailures lists the pairs of a report that carry an error
+func reportFailures(rep report) []pairFailure {
+	failures := []pairFailure{}
+	for src, remotes := range rep.Results {
+		for _, remote := range remotes {
+			if remote.Error == "" {
+				continue
+			}
+			failures = append(failures, pairFailure{
+				Src:   src,
+				Dst:   remote.Addr,
+				Error: remote.Error,
+			})
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Src != failures[j].Src {
+			return failures[i].Src < failures[j].Src
+		}
+		return failures[i].Dst < failures[j].Dst
+	})
+	return failures
+}
+
+// corruptedEdges lists the pairs whose receiver found corrupted blocks
+func corruptedEdges(rep report) []edge {
+	corrupted := []edge{}
+	for _, e := range reportEdges(rep) {
+		if e.Perf.Integrity != nil && e.Perf.Integrity.Corrupted > 0 {
+			corrupted = append(corrupted, e)
+		}
+	}
+	sort.Slice(corrupted, func(i, j int) bool {
+		return pairKey(corrupted[i].Src, corrupted[i].Dst) < pairKey(corrupted[j].Src, corrupted[j].Dst)
+	})
+	return corrupted
+}
+
+// rejectedEdges lists the pairs with requests the receiver rejected
+func rejectedEdges(rep report) []edge {
+	rejected := []edge{}
+	for _, e := range reportEdges(rep) {
+		if e.Perf.Receiver != nil && e.Perf.Receiver.Rejected > 0 {
+			rejected = append(rejected, e)
+		}
+	}
+	sort.Slice(rejected, func(i, j int) bool {
+		return pairKey(rejected[i].Src, rejected[i].Dst) < pairKey(rejected[j].Src, rejected[j].Dst)
+	})
+	return rejected
+}
+
+// timedOutEdges lists the pairs with requests that did not complete in
+// time, which are left out of their throughput and latency
+func timedOutEdges(rep report) []edge {
+	timedOut := []edge{}
+	for _, e := range reportEdges(rep) {
+		if e.Perf.Receiver != nil && e.Perf.Receiver.TimedOut > 0 {
+			timedOut = append(timedOut, e)
+		}
+	}
+	sort.Slice(timedOut, func(i, j int) bool {
+		return pairKey(timedOut[i].Src, timedOut[i].Dst) < pairKey(timedOut[j].Src, timedOut[j].Dst)
+	})
+	return timedOut
+}
+
+// nodePercentiles are merged from the histograms of several pairs
+type nodePercentiles struct {
+	Latency    perf.Latency
+	Throughput perf.Throughput
+	Pairs      int
+}
+
+// clusterPercentiles holds percentiles merged across pairs, which unlike
+// averages of per-pair percentiles are accurate
+type clusterPercentiles struct {
+	Cluster nodePercentiles
+	// Nodes holds the percentiles of the pairs each node took part in
+	Nodes map[string]nodePercentiles
+}
+
+// mergePercentiles merges the histograms of every edge, cluster-wide and
+// for each node the edge touches
+func mergePercentiles(rep report) (*clusterPercentiles, error) {
+	type merged struct {
+		latency    perf.Histogram
+		throughput perf.Histogram
+		pairs      int
+	}
+	cluster := &merged{}
+	nodes := map[string]*merged{}
+	add := func(m *merged, h perf.Histograms) error {
+		if err := m.latency.Merge(&h.Latency); err != nil {
+			return err
+		}
+		if err := m.throughput.Merge(&h.Throughput); err != nil {
+			return err
+		}
+		m.pairs++
+		return nil
+	}
+
+	for _, e := range primaryEdges(rep) {
+		if err := add(cluster, e.Perf.Histograms); err != nil {
+			return nil, err
+		}
+		for _, addr := range []string{e.Src, e.Dst} {
+			if nodes[addr] == nil {
+				nodes[addr] = &merged{}
+			}
+			if err := add(nodes[addr], e.Perf.Histograms); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cluster.pairs == 0 {
+		return nil, nil
+	}
+
+	summarize := func(m *merged) nodePercentiles {
+		return nodePercentiles{
+			Latency:    m.latency.Latency(percentiles...),
+			Throughput: m.throughput.Throughput(percentiles...),
+			Pairs:      m.pairs,
+		}
+	}
+	cp := &clusterPercentiles{
+		Cluster: summarize(cluster),
+		Nodes:   map[string]nodePercentiles{},
+	}
+	for addr, m := range nodes {
+		cp.Nodes[addr] = summarize(m)
+	}
+	return cp, nil
+}
+
+// summarizeReport fills in the aggregates of a report from its results
+func summarizeReport(rep *report) error {
+	if len(reportEdges(*rep)) == 0 {
+		// patterns other than mesh keep their results apart
+		return nil
+	}
+	rep.Aggregate = aggregateByLabels(*rep)
+	cp, err := mergePercentiles(*rep)
+	if err != nil {
+		return err
+	}
+	rep.Percentiles = cp
+	ms := reportMeasurements(*rep)
+	rep.Attribution = attribute(ms)
+	rep.Asymmetry = analysis.DetectAsymmetry(ms, analysis.DefaultAsymmetryOptions)
+	rep.DualStack = dualStackPairs(*rep)
+	return nil
+}
+
+// reportMeasurements returns the edges of a report for the analysis
+func reportMeasurements(rep report) []analysis.Measurement {
+	ms := []analysis.Measurement{}
+	for _, e := range primaryEdges(rep) {
+		if e.Perf.Throughput.Avg <= 0 {
+			continue
+		}
+		ms = append(ms, analysis.Measurement{
+			Src:        e.Src,
+			Dst:        e.Dst,
+			Throughput: e.Perf.Throughput.Avg,
+			Latency:    e.Perf.Latency.Avg,
+			Streams:    e.Perf.Streams,
+		})
+	}
+	return ms
+}
+
+// attribute fits node capacities to the measurements, or returns nil if
+// there are too few nodes
+func attribute(ms []analysis.Measurement) *analysis.Attribution {
+	att, err := analysis.Attribute(ms, analysis.DefaultOptions)
+	if err != nil {
+		return nil
+	}
+	return att
+}
+
+func printAsymmetry(asym *analysis.Asymmetry) {
+	if asym == nil {
+		return
+	}
+	pairs, nodes := asym.AsymmetricPairs(), asym.AsymmetricNodes()
+	if len(pairs) == 0 && len(nodes) == 0 {
+		fmt.Println("No asymmetric pair or node found.")
+		return
+	}
+	if len(pairs) > 0 {
+		fmt.Println("Asymmetric pairs:")
+		for _, p := range pairs {
+			fmt.Printf("  %s <-> %s : %s/s forward, %s/s reverse, latency %s forward, %s reverse\n", p.A, p.B,
+				humanize.IBytes(uint64(p.ForwardThroughput)), humanize.IBytes(uint64(p.ReverseThroughput)),
+				time.Duration(p.ForwardLatency*float64(time.Second)).Round(time.Millisecond),
+				time.Duration(p.ReverseLatency*float64(time.Second)).Round(time.Millisecond))
+		}
+	}
+	if len(nodes) > 0 {
+		fmt.Println("Nodes sending and receiving at different rates:")
+		for _, n := range nodes {
+			fmt.Printf("  %s : transmit/receive %.2f relative to a typical node (confidence %.0f%%)\n",
+				n.Node, n.Ratio, 100*n.Confidence)
+		}
+	}
+}
+
+func printAttribution(att *analysis.Attribution) {
+	if att == nil {
+		return
+	}
+	nodes, links := att.AnomalousNodes(), att.AnomalousLinks()
+	if len(nodes) == 0 && len(links) == 0 {
+		fmt.Println("No slow node or link found.")
+		return
+	}
+	if len(nodes) > 0 {
+		fmt.Println("Slow nodes:")
+		for _, n := range nodes {
+			fmt.Printf("  %s : %s/s, %.0f%% of a typical node (confidence %.0f%%)\n", n.Node,
+				humanize.IBytes(uint64(n.Capacity)), 100*n.Ratio, 100*n.Confidence)
+		}
+	}
+	if len(links) > 0 {
+		fmt.Println("Slow links:")
+		for _, l := range links {
+			fmt.Printf("  %s : %s/s, %.0f%% of the expected %s/s (confidence %.0f%%)\n", pairKey(l.Src, l.Dst),
+				humanize.IBytes(uint64(l.Measured)), 100*l.Ratio, humanize.IBytes(uint64(l.Expected)), 100*l.Confidence)
+		}
+	}
+}
+
+func printClusterPercentiles(cp *clusterPercentiles) {
+	if cp == nil {
+		return
+	}
+	t := cp.Cluster.Throughput
+	fmt.Printf("Cluster throughput over %d pairs: p50 %s/s, p90 %s/s, p99 %s/s\n", cp.Cluster.Pairs,
+		humanize.IBytes(uint64(t.Percentile50)), humanize.IBytes(uint64(t.Percentile90)), humanize.IBytes(uint64(t.Percentile99)))
+}
+
+// pairThroughput is the average throughput measured between two nodes
+type pairThroughput struct {
+	Src        string
+	Dst        string
+	Throughput float64
+}
+
+// rackThroughput is the average throughput of all pairs touching a rack
+type rackThroughput struct {
+	Rack       string
+	Zone       string `json:",omitempty"`
+	Throughput float64
+	Pairs      int
+}
+
+// labelAggregate summarizes throughput by rack and zone labels
+type labelAggregate struct {
+	RackLabel string
+	ZoneLabel string
+
+	IntraRack      float64
+	IntraRackPairs int
+	InterRack      float64
+	InterRackPairs int
+	InterZone      float64
+	InterZonePairs int
+
+	WorstInterRack *pairThroughput `json:",omitempty"`
+	// RackRanking lists racks, slowest first
+	RackRanking []rackThroughput
+}
+
+// aggregateByLabels groups edges into intra-rack, inter-rack and
+// inter-zone classes. Racks are scoped by zone, so the same rack name
+// in two zones denotes two racks. Returns nil if no node carries the
+// rack label.
+func aggregateByLabels(rep report) *labelAggregate {
+	type location struct {
+		rack string
+		zone string
+	}
+	locations := map[string]location{}
+	for addr, n := range rep.Nodes {
+		rack, ok := n.Labels[rackLabel]
+		if !ok {
+			continue
+		}
+		locations[addr] = location{
+			rack: rack,
+			zone: n.Labels[zoneLabel],
+		}
+	}
+	if len(locations) == 0 {
+		return nil
+	}
+
+	agg := &labelAggregate{
+		RackLabel: rackLabel,
+		ZoneLabel: zoneLabel,
+	}
+
+	type rackSum struct {
+		location
+		sum   float64
+		pairs int
+	}
+	racks := map[location]*rackSum{}
+	addToRack := func(l location, t float64) {
+		r, ok := racks[l]
+		if !ok {
+			r = &rackSum{location: l}
+			racks[l] = r
+		}
+		r.sum += t
+		r.pairs++
+	}
+
+	for _, e := range primaryEdges(rep) {
+		src, srcOk := locations[e.Src]
+		dst, dstOk := locations[e.Dst]
+		if !srcOk || !dstOk {
+			continue
+		}
+		t := e.Perf.Throughput.Avg
+		switch {
+		case src.zone != "" && dst.zone != "" && src.zone != dst.zone:
+			agg.InterZone += t
+			agg.InterZonePairs++
+		case src == dst:
+			agg.IntraRack += t
+			agg.IntraRackPairs++
+		default:
+			agg.InterRack += t
+			agg.InterRackPairs++
+			if agg.WorstInterRack == nil || t < agg.WorstInterRack.Throughput {
+				agg.WorstInterRack = &pairThroughput{
+					Src:        e.Src,
+					Dst:        e.Dst,
+					Throughput: t,
+				}
+			}
+		}
+		addToRack(src, t)
+		if dst != src {
+			addToRack(dst, t)
+		}
+	}
+
+	if agg.IntraRackPairs > 0 {
+		agg.IntraRack /= float64(agg.IntraRackPairs)
+	}
+	if agg.InterRackPairs > 0 {
+		agg.InterRack /= float64(agg.InterRackPairs)
+	}
+	if agg.InterZonePairs > 0 {
+		agg.InterZone /= float64(agg.InterZonePairs)
+	}
+
+	for _, r := range racks {
+		agg.RackRanking = append(agg.RackRanking, rackThroughput{
+			Rack:       r.rack,
+			Zone:       r.zone,
+			Throughput: r.sum / float64(r.pairs),
+			Pairs:      r.pairs,
+		})
+	}
+	sort.Slice(agg.RackRanking, func(i, j int) bool {
+		return agg.RackRanking[i].Throughput < agg.RackRanking[j].Throughput
+	})
+	return agg
+}
+
+func printLabelAggregate(agg *labelAggregate) {
+	if agg == nil {
+		return
+	}
+	class := func(name string, t float64, pairs int) {
+		if pairs == 0 {
+			fmt.Printf("  %-11s: -\n", name)
+			return
+		}
+		fmt.Printf("  %-11s: %s/s (%d pairs)\n", name, humanize.IBytes(uint64(t)), pairs)
+	}
+
+	fmt.Printf("Throughput by '%s' and '%s' labels:\n", agg.RackLabel, agg.ZoneLabel)
+	class("intra-rack", agg.IntraRack, agg.IntraRackPairs)
+	class("inter-rack", agg.InterRack, agg.InterRackPairs)
+	class("inter-zone", agg.InterZone, agg.InterZonePairs)
+	if w := agg.WorstInterRack; w != nil {
+		fmt.Printf("Slowest inter-rack pair: %s -> %s : %s/s\n", w.Src, w.Dst, humanize.IBytes(uint64(w.Throughput)))
+	}
+	fmt.Printf("Racks, slowest first:\n")
+	for i, r := range agg.RackRanking {
+		name := r.Rack
+		if r.Zone != "" {
+			name = fmt.Sprintf("%s (%s=%s)", r.Rack, agg.ZoneLabel, r.Zone)
+		}
+		fmt.Printf("%d. %s : %s/s\n", i+1, name, humanize.IBytes(uint64(r.Throughput)))
+	}
+}
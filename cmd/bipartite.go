@@ -0,0 +1,199 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+)
+
+// bipartiteWeakest is how many of the slowest cross-site pairs are reported
+const bipartiteWeakest = 5
+
+// siteCapacity is the cross-site throughput in one direction
+type siteCapacity struct {
+	Src string
+	Dst string
+	// Capacity is the highest sum of the throughput of the pairs tested
+	// at the same time, Concurrent of them
+	Capacity   float64
+	Concurrent int
+	// Average is the mean throughput of a pair
+	Average float64
+	Pairs   int
+}
+
+// bipartiteReport summarizes the traffic between two groups of nodes
+type bipartiteReport struct {
+	Groups     []string
+	Directions []siteCapacity
+	// Weakest are the slowest cross-site pairs, slowest first
+	Weakest []pairThroughput
+}
+
+// splitGroups returns the two groups the nodes joined with --group
+func splitGroups(nodes []*node) ([]string, [][]*node, error) {
+	names := []string{}
+	members := map[string][]*node{}
+	for _, n := range nodes {
+		if n.Group == "" {
+			return nil, nil, fmt.Errorf("node %s has no --group", n.Addr)
+		}
+		if _, ok := members[n.Group]; !ok {
+			names = append(names, n.Group)
+		}
+		members[n.Group] = append(members[n.Group], n)
+	}
+	if len(names) != 2 {
+		return nil, nil, fmt.Errorf("bipartite tests expect two groups, found %d", len(names))
+	}
+	sort.Strings(names)
+	return names, [][]*node{members[names[0]], members[names[1]]}, nil
+}
+
+// bipartiteRounds splits every pair of a node of a and a node of b into
+// rounds of disjoint pairs, a sending to b. Each round shifts the nodes
+// of the larger group by one.
+func bipartiteRounds(a, b []*node) [][]pair {
+	small, large := a, b
+	if len(a) > len(b) {
+		small, large = b, a
+	}
+	rounds := [][]pair{}
+	for r := range large {
+		round := []pair{}
+		for i, n := range small {
+			m := large[(i+r)%len(large)]
+			if len(a) > len(b) {
+				round = append(round, pair{src: m, dst: n})
+			} else {
+				round = append(round, pair{src: n, dst: m})
+			}
+		}
+		rounds = append(rounds, round)
+	}
+	return rounds
+}
+
+// runBipartite tests only the pairs across the two groups, in both
+// directions, and adds the results to rep
+func runBipartite(ctx context.Context, nodes []*node, rep *report) error {
+	groups, members, err := splitGroups(nodes)
+	if err != nil {
+		return err
+	}
+	rounds := bidirectionalRounds(bipartiteRounds(members[0], members[1]))
+	if serialTests {
+		rounds = serialRounds(rounds)
+	}
+
+	groupOf := map[string]string{}
+	for _, n := range nodes {
+		groupOf[n.Addr] = n.Group
+	}
+	directions := map[string]*siteCapacity{}
+	for _, d := range [][]string{{groups[0], groups[1]}, {groups[1], groups[0]}} {
+		directions[d[0]] = &siteCapacity{Src: d[0], Dst: d[1]}
+	}
+
+	view, stop := observeRounds(rounds)
+	defer stop()
+
+	bip := &bipartiteReport{Groups: groups}
+	rep.Bipartite = bip
+	for r, round := range rounds {
+		view.startRound(r+1, len(round))
+		remotes := runRound(ctx, view, newTestOptions(), round)
+		view.endRound()
+
+		sum := map[string]float64{}
+		concurrent := map[string]int{}
+		for i, remote := range remotes {
+			if remote == nil {
+				continue
+			}
+			src := round[i].src
+			rep.Results[src.Addr] = append(rep.Results[src.Addr], remote)
+			if remote.Error != "" {
+				continue
+			}
+			t := 0.0
+			for _, p := range remote.Perf {
+				t += p.Throughput.Avg
+			}
+			d := directions[src.Group]
+			d.Average += t
+			d.Pairs++
+			sum[src.Group] += t
+			concurrent[src.Group]++
+			bip.Weakest = append(bip.Weakest, pairThroughput{
+				Src:        src.Addr,
+				Dst:        round[i].dst.Addr,
+				Throughput: t,
+			})
+		}
+		for g, t := range sum {
+			if d := directions[g]; t > d.Capacity {
+				d.Capacity, d.Concurrent = t, concurrent[g]
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	sortResults(rep.Results)
+
+	for _, g := range groups {
+		d := directions[g]
+		if d.Pairs > 0 {
+			d.Average /= float64(d.Pairs)
+		}
+		bip.Directions = append(bip.Directions, *d)
+	}
+	sort.Slice(bip.Weakest, func(i, j int) bool {
+		return bip.Weakest[i].Throughput < bip.Weakest[j].Throughput
+	})
+	if len(bip.Weakest) > bipartiteWeakest {
+		bip.Weakest = bip.Weakest[:bipartiteWeakest]
+	}
+	return ctx.Err()
+}
+
+func printBipartite(rep *bipartiteReport) {
+	if rep == nil {
+		return
+	}
+	fmt.Printf("Cross-site capacity between '%s' and '%s':\n", rep.Groups[0], rep.Groups[1])
+	for _, d := range rep.Directions {
+		if d.Pairs == 0 {
+			fmt.Printf("  %s -> %s : -\n", d.Src, d.Dst)
+			continue
+		}
+		fmt.Printf("  %s -> %s : %s/s over %d concurrent pair(s), %s/s per pair on average\n", d.Src, d.Dst,
+			humanize.IBytes(uint64(d.Capacity)), d.Concurrent, humanize.IBytes(uint64(d.Average)))
+	}
+	if len(rep.Weakest) > 0 {
+		fmt.Printf("Weakest cross-site pairs:\n")
+		for i, p := range rep.Weakest {
+			fmt.Printf("%d. %s : %s/s\n", i+1, pairKey(p.Src, p.Dst), humanize.IBytes(uint64(p.Throughput)))
+		}
+	}
+}
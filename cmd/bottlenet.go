@@ -24,11 +24,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"os"
-	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/minio/minio/pkg/console"
@@ -49,6 +48,7 @@ Run the following command on each of the client nodes.
 
 var (
 	firstPeer         = false
+	testRunning       int32
 	selfStartCtx      context.Context
 	selfStartCancelFn func()
 	testChan          chan struct{}
@@ -56,17 +56,25 @@ var (
 
 func init() {
 	selfStartCtx, selfStartCancelFn = context.WithCancel(context.Background())
-	testChan = make(chan struct{})
+	testChan = make(chan struct{}, 1)
+}
+
+// peersChanged tells the prompt or the dashboard that peers joined or
+// left. Nothing reads testChan with --peers or --min-peers, so the
+// change is dropped if one is already pending.
+func peersChanged() {
+	select {
+	case testChan <- struct{}{}:
+	default:
+	}
 }
 
 func bottlenet(ctx context.Context) error {
-	printBottlenetMessage()
-	peers = []*node{
-		{
-			NodeType: nodeTypeSelf,
-			Addr:     getLocalIPs()[0],
-		},
+	defer restoreTerminal()
+	if len(staticPeers) == 0 && peersFile == "" {
+		printBottlenetMessage()
 	}
+	peers = []*node{newSelfNode(nodeTypeSelf)}
 
 	if clientMode {
 		peers[0].NodeType = nodeTypeClient
@@ -75,20 +83,52 @@ func bottlenet(ctx context.Context) error {
 		peers[0].NodeType = nodeTypeServer
 	}
 
-	go runTestController()
+	addrs, err := staticPeerAddrs()
+	if err != nil {
+		return err
+	}
+	if len(addrs) > 0 {
+		if tuiMode {
+			dash = newDashboard()
+			go runDashboard()
+		}
+		go func() {
+			<-serverReady
+			if err := addStaticPeers(ctx, addrs); err != nil {
+				fmt.Println(err.Error())
+				exitProcess(1)
+			}
+			fmt.Println("running bottlenet tests...")
+			runTest()
+		}()
+	} else {
+		if discover != "" {
+			go func() {
+				<-serverReady
+				discoverPeers(ctx)
+			}()
+		}
+		if tuiMode {
+			dash = newDashboard()
+			go runDashboard()
+		} else if discover == "" || minPeers == 0 {
+			go runTestController()
+		}
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/join", listenJoin)
 	mux.HandleFunc("/start", listenStart)
+	mux.HandleFunc("/retest", listenRetest)
 	return serveBottlenet(ctx, mux)
 }
 
-func doStart(ctx context.Context, coordinator string) (map[string][]*node, error) {
+func doStart(ctx context.Context, coordinator string) (report, error) {
 	client := newClient()
-	perfMap := map[string][]*node{}
+	perfMap := report{}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("http://%s/%s", coordinator, "start"), nil)
+		bottlenetURL(coordinator, "start"), nil)
 	if err != nil {
 		return perfMap, err
 	}
@@ -119,46 +159,87 @@ func doStart(ctx context.Context, coordinator string) (map[string][]*node, error
 }
 
 func listenStart(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
 	endpointsMap := map[string][]*node{}
-
-	for _, p := range peers {
-		if clientMode || serverMode {
-			break
-		}
-		if p.Addr == getLocalIPs()[0] {
-			continue
-		}
-		err := doPerf(ctx, p)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	nodesMap := map[string]*node{}
+
+	nodeLock.Lock()
+	nodes := append([]*node{}, peers...)
+	nodeLock.Unlock()
+
+	for _, p := range nodes {
+		nodesMap[p.Addr] = &node{
+			NodeType: p.NodeType,
+			Addr:     p.Addr,
+			AltAddr:  p.AltAddr,
+			Version:  p.Version,
+			Host:     p.Host,
+			Labels:   p.Labels,
+			Group:    p.Group,
 		}
+		endpointsMap[p.Addr] = []*node{}
 	}
 
-	for i, p := range peers {
-		remotes := []*node{}
-		for j, p := range peers {
-			if j >= i && !clientMode && !serverMode {
-				break
-			}
-			pnew := new(node)
-			pnew.Addr = p.Addr
-			pnew.Perf = p.Perf
-			pnew.NodeType = p.NodeType
-			remotes = append(remotes, pnew)
-		}
-		endpointsMap[p.Addr] = remotes
+	ctx, stopRun := startRun(r.Context(), nodes)
+	defer stopRun()
+
+	rep := report{
+		Nodes:   nodesMap,
+		Results: endpointsMap,
 	}
 
-	for addr, remotes := range endpointsMap {
-		if err := doDispatch(ctx, addr, remotes); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	status := ""
+	if clientMode || serverMode {
+		for _, p := range nodes {
+			remotes := []*node{}
+			for _, p := range nodes {
+				remotes = append(remotes, &node{
+					NodeType: p.NodeType,
+					Addr:     p.Addr,
+					AltAddr:  p.AltAddr,
+				})
+			}
+			if err := doDispatch(ctx, p.Addr, newTestOptions(), remotes, nil); err != nil {
+				if ctx.Err() != nil {
+					status = statusCancelled
+					break
+				}
+				// the client could not report, fail all of its pairs
+				for _, remote := range remotes {
+					if p.NodeType == nodeTypeClient && remote.NodeType == nodeTypeServer {
+						remote.Error = pairError(err)
+					}
+				}
+			}
+			endpointsMap[p.Addr] = remotes
+		}
+	} else if pattern != patternMesh {
+		if err := runPattern(ctx, nodes, &rep); err != nil {
+			if ctx.Err() == nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			status = statusCancelled
+		}
+	} else {
+		rounds := meshRounds(nodes)
+		if bidirectional {
+			rounds = bidirectionalRounds(rounds)
+		}
+		if serialTests {
+			rounds = serialRounds(rounds)
+		}
+		results, err := runRounds(ctx, rounds)
+		if err != nil {
+			// cancelled through /cancel, report the pairs tested so far
+			status = statusCancelled
+		}
+		for addr, remotes := range results {
+			endpointsMap[addr] = remotes
 		}
 	}
 
-	dispatchMap, err := json.MarshalIndent(endpointsMap, "", " ")
+	rep.Status = status
+	dispatchMap, err := json.MarshalIndent(rep, "", " ")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -170,10 +251,7 @@ func listenStart(w http.ResponseWriter, r *http.Request) {
 func doJoin(ctx context.Context, coordinator string, connbrk chan error) error {
 	client := newClient()
 
-	n := &node{
-		NodeType: nodeTypePeer,
-		Addr:     getLocalIPs()[0],
-	}
+	n := newSelfNode(nodeTypePeer)
 
 	if clientMode {
 		n.NodeType = nodeTypeClient
@@ -188,7 +266,7 @@ func doJoin(ctx context.Context, coordinator string, connbrk chan error) error {
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("http://%s/%s", coordinator, "join"), bytes.NewReader(nBytes))
+		bottlenetURL(coordinator, "join"), bytes.NewReader(nBytes))
 	if err != nil {
 		return err
 	}
@@ -225,10 +303,10 @@ func listenJoin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.(http.Flusher).Flush()
-	testChan <- struct{}{}
+	peersChanged()
 	<-r.Context().Done()
 	fmt.Println("Peer disconnected. Exiting.")
-	os.Exit(1)
+	exitProcess(1)
 	removePeer(p)
 }
 
@@ -253,6 +331,19 @@ func runTestController() {
 }
 
 func runTest() {
+	if dash != nil {
+		if !dash.start() {
+			dash.setMessage("tests are already running")
+		}
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&testRunning, 0, 1) {
+		fmt.Println("tests are already running")
+		return
+	}
+	defer atomic.StoreInt32(&testRunning, 0)
+
 	selfStartCancelFn()
 	<-selfStartCtx.Done()
 	selfStartCtx, selfStartCancelFn = context.WithCancel(context.Background())
@@ -267,122 +358,102 @@ func runTest() {
 	selfStartCancelFn()
 }
 
-func printResults(results map[string][]*node) {
-	/*
-	           10       10       5
-	       a  <-->  b  <-->  c  <-->  d
-	    10 |      5 |               5 |
-	       c        d                 a
-
-	   A simple algorithm to derive the slowest node
-	   from the edge speeds is to compute the sum of
-	   individual edges directly connected to each edge.
-
-	   For instance, the speed of node a will be
-	       s(a->b) + s(a->c) + s(a->d)
-
-	   This algorithm is based on the assumption that incoming
-	   and outgoing speed on a specific node are the same.
-	*/
-
+func printResults(rep report) {
 	exit := 0
+	saved := false
 
 	defer func() {
+		if keepAlive && saved {
+			fmt.Println("Waiting for retest requests, press Ctrl-C to exit.")
+			return
+		}
 		fmt.Println("Exiting.")
-		os.Exit(exit)
+		exitProcess(exit)
 	}()
 
-	stackRankMap := map[string]float64{}
-	total := float64(0)
-	for kout := range results {
-		nodeAvgSum := float64(0)
-		nodeMax := float64(0)
-		for kin, v := range results {
-			if kin == kout {
-				for _, vi := range v {
-					for _, vx := range vi.Perf {
-						nodeAvgSum = nodeAvgSum + vx.Throughput.Avg
-						nodeMax = func() float64 {
-							if vx.Throughput.Max > nodeMax {
-								return vx.Throughput.Max
-							}
-							return nodeMax
-						}()
-						total = total + vx.Throughput.Avg
-					}
-				}
-				continue
-			}
-			for _, vi := range v {
-				for kx, vx := range vi.Perf {
-					if kx == kout {
-						nodeAvgSum = nodeAvgSum + vx.Throughput.Avg
-						nodeMax = func() float64 {
-							if vx.Throughput.Max > nodeMax {
-								return vx.Throughput.Max
-							}
-							return nodeMax
-						}()
-					}
-				}
-			}
+	if err := summarizeReport(&rep); err != nil {
+		fmt.Println(err)
+	}
+	printLabelAggregate(rep.Aggregate)
+	printClusterPercentiles(rep.Percentiles)
+	printAttribution(rep.Attribution)
+	printAsymmetry(rep.Asymmetry)
+	printDualStack(rep.DualStack)
+	printIncast(rep.Incast)
+	printFanout(rep.Fanout)
+	printPlan(rep.Plan)
+	printBipartite(rep.Bipartite)
+
+	failures := reportFailures(rep)
+	if len(failures) > 0 {
+		fmt.Printf("%s %d pair(s) failed:\n", warnText(dot), len(failures))
+		for _, f := range failures {
+			fmt.Printf("  %s : %s\n", pairKey(f.Src, f.Dst), f.Error)
 		}
-		stackRankMap[kout] = nodeMax
+		exit = 1
 	}
-
-	stackRankKeys := []string{}
-
-	for i := range stackRankMap {
-		stackRankKeys = append(stackRankKeys, i)
+	if corrupted := corruptedEdges(rep); len(corrupted) > 0 {
+		fmt.Printf("%s %d pair(s) received corrupted data:\n", warnText(dot), len(corrupted))
+		for _, e := range corrupted {
+			fmt.Printf("  %s : %d of %d blocks corrupted in %d request(s)\n", e.key(),
+				e.Perf.Integrity.Corrupted, e.Perf.Integrity.Blocks, e.Perf.Integrity.CorruptedRequests)
+		}
+		exit = 1
+	} else if verifyData {
+		fmt.Println("No corrupted data found.")
+	}
+	if rejected := rejectedEdges(rep); len(rejected) > 0 {
+		fmt.Printf("%s %d pair(s) had requests rejected by the receiver:\n", warnText(dot), len(rejected))
+		for _, e := range rejected {
+			fmt.Printf("  %s : %d request(s), last: %s\n", e.key(),
+				e.Perf.Receiver.Rejected, e.Perf.Receiver.LastError)
+		}
+		exit = 1
 	}
-
-	sort.Slice(stackRankKeys, func(i, j int) bool {
-		left := stackRankKeys[i]
-		right := stackRankKeys[j]
-		return stackRankMap[left] < stackRankMap[right]
-	})
-
-	max := float64(0)
-	avg := float64(0)
-	for _, k := range stackRankMap {
-		k = k / float64(len(stackRankMap)-1)
-		avg = avg + k
-		if k > max {
-			max = k
+	if timedOut := timedOutEdges(rep); len(timedOut) > 0 {
+		fmt.Printf("%s %d pair(s) had requests time out, left out of their results:\n", warnText(dot), len(timedOut))
+		for _, e := range timedOut {
+			fmt.Printf("  %s : %d request(s)\n", e.key(), e.Perf.Receiver.TimedOut)
 		}
 	}
 
-	// avg = avg / float64(len(stackRankKeys))
-	// fmt.Printf("Slowest nodes in your network:\n")
-	// for n, k := range stackRankKeys {
-	//     s := stackRankMap[k]
-	//     ks := k + strings.Repeat(" ", 21-len(k))
-	//     fmt.Printf("%d. %s : %s/s \n", n+1, ks, humanize.IBytes(uint64(s)))
-	// }
-
-	resJSON, err := json.MarshalIndent(results, "", " ")
+	filename, err := saveResults(rep)
 	if err != nil {
 		fmt.Println(err)
 		exit = 1
 		return
 	}
+	saved = true
+	storeReport(rep, filename)
+	if rep.Status == statusCancelled {
+		fmt.Println("Bottlenet tests cancelled, partial results saved to", filename)
+		exit = 1
+		return
+	}
+	fmt.Println("Bottlenet results saved to", filename)
+}
 
+// saveResults writes the report to a timestamped json file in the
+// current directory and returns its name
+func saveResults(rep report) (string, error) {
 	filename := fmt.Sprintf("bottlenet_%s.json", time.Now().Format("20060102150405"))
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0666)
+	return filename, writeReport(rep, filename)
+}
+
+func writeReport(rep report, filename string) error {
+	resJSON, err := json.MarshalIndent(rep, "", " ")
 	if err != nil {
-		fmt.Println(err)
-		exit = 1
-		return
+		return err
 	}
-	defer f.Close()
 
-	_, err = f.Write(resJSON)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
 	if err != nil {
-		fmt.Println(err)
-		exit = 1
-		return
+		return err
 	}
-	fmt.Println("Bottlenet results saved to", filename)
+	defer f.Close()
+
+	_, err = f.Write(resJSON)
+	return err
 }
 
 func printBottlenetMessage() {
@@ -394,27 +465,3 @@ func printBottlenetMessage() {
 	coordMsg := strings.ReplaceAll(coordinatorMessage, "THIS-SERVER-ADDR", getLocalIPs()[0])
 	fmt.Printf("%s\n", coordMsg)
 }
-
-func getLocalIPs() []string {
-	if address != ":7007" {
-		return []string{address}
-	}
-	ips := []string{}
-
-	interfaceAddrs, err := net.InterfaceAddrs()
-	if err != nil {
-		panic(err)
-	}
-
-	return append(ips, func() []string {
-		toRet := []string{}
-		for _, inter := range interfaceAddrs {
-			ip, _, _ := net.ParseCIDR(inter.String())
-			if !ip.IsLoopback() {
-				toRet = append(toRet, fmt.Sprintf("%s:7007", ip.String()))
-			}
-		}
-		return toRet
-	}()...)
-
-}
@@ -0,0 +1,178 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// statusCancelled marks a report whose run was cancelled before every
+// pair was tested
+const statusCancelled = "cancelled"
+
+var (
+	dispatchLock    sync.Mutex
+	dispatchID      int
+	dispatchCancels = map[int]context.CancelFunc{}
+
+	runLock     sync.Mutex
+	runCancelFn context.CancelFunc
+	runNodes    []*node
+)
+
+// trackDispatch registers the cancel func of an in-flight dispatch so
+// that /cancel can stop it, and returns the func that unregisters it
+func trackDispatch(cancel context.CancelFunc) func() {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+	dispatchID++
+	id := dispatchID
+	dispatchCancels[id] = cancel
+	return func() {
+		dispatchLock.Lock()
+		defer dispatchLock.Unlock()
+		delete(dispatchCancels, id)
+	}
+}
+
+// cancelDispatches stops every test this node is sending
+func cancelDispatches() {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+	for _, cancel := range dispatchCancels {
+		cancel()
+	}
+}
+
+// startRun registers the run coordinated by this node, so that it can
+// be cancelled along with the tests of every node taking part in it
+func startRun(ctx context.Context, nodes []*node) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	runLock.Lock()
+	runCancelFn = cancel
+	runNodes = nodes
+	runLock.Unlock()
+
+	return ctx, func() {
+		runLock.Lock()
+		runCancelFn = nil
+		runNodes = nil
+		runLock.Unlock()
+		cancel()
+	}
+}
+
+// cancelRun cancels the run coordinated by this node and asks every node
+// taking part in it to stop its tests. Returns false if no run is active.
+func cancelRun() bool {
+	runLock.Lock()
+	cancel, nodes := runCancelFn, runNodes
+	runCancelFn, runNodes = nil, nil
+	runLock.Unlock()
+
+	if cancel == nil {
+		return false
+	}
+	cancel()
+
+	wg := sync.WaitGroup{}
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := doCancel(context.Background(), addr); err != nil {
+				fmt.Printf("could not cancel tests on %s: %v\n", addr, err)
+			}
+		}(n.Addr)
+	}
+	wg.Wait()
+	return true
+}
+
+func listenCancel(w http.ResponseWriter, r *http.Request) {
+	// answer first, the coordinator may exit as soon as its run stops
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	cancelRun()
+	cancelDispatches()
+}
+
+func doCancel(ctx context.Context, addr string) error {
+	client := newClient()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, bottlenetURL(addr, "cancel"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf(strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+var cancelCoordinator = ""
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel [--coordinator ADDR]",
+	Short: "Cancel the tests running on a coordinator and all of its peers",
+	Long: `
+Cancel the tests running on a coordinator. The coordinator stops the tests on
+every peer and writes a partial report of the pairs tested so far.
+
+  $>_ bottlenet cancel --coordinator COORDINATOR-IP:PORT
+`,
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	SilenceUsage:          true,
+	SilenceErrors:         true,
+	RunE: func(c *cobra.Command, args []string) error {
+		coordinator := cancelCoordinator
+		if coordinator == "" {
+			coordinator = getLocalIPs()[0]
+		}
+		if err := doCancel(context.Background(), coordinator); err != nil {
+			return err
+		}
+		fmt.Println("Bottlenet tests cancelled on", coordinator)
+		return nil
+	},
+}
+
+func init() {
+	cancelCmd.Flags().StringVar(&cancelCoordinator, "coordinator", cancelCoordinator, "address of the coordinator (default: this node)")
+	bottlenetCmd.AddCommand(cancelCmd)
+}
@@ -21,7 +21,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/minio/bottlenet/pkg/payload"
 	"github.com/spf13/cobra"
 )
 
@@ -31,7 +33,8 @@ var (
 )
 
 var bottlenetCmd = &cobra.Command{
-	Use: fmt.Sprintf("%s [IP...] [-a]", os.Args[0]),
+	Use:  fmt.Sprintf("%s [IP...] [-a]", os.Args[0]),
+	Args: cobra.ArbitraryArgs,
 	RunE: func(c *cobra.Command, args []string) error {
 		return bottlenetEntrypoint(context.Background(), args)
 	},
@@ -60,15 +63,180 @@ In order to bind bottlenet to specific interface and port
 Note: --address should be applied to both control and peer nodes
 
   $>_ bottlenet --address IP:PORT CONTROL-SERVER-IP:PORT
+
+In order to pick the advertised address by interface or network
+
+  $>_ bottlenet --interface eth1 CONTROL-SERVER-IP:PORT
+  $>_ bottlenet --network 10.20.0.0/16 CONTROL-SERVER-IP:PORT
+
+IPv6 addresses are given in brackets. In order to test dual-stack pairs over both families
+
+  $>_ bottlenet --dual-stack [CONTROL-SERVER-IPV6]:PORT
+
+In order to group results, label each node
+
+  $>_ bottlenet --label rack=r12 --label zone=a CONTROL-SERVER-IP:PORT
+
+In order to run against permanently running agents, without a join step
+
+  $>_ bottlenet --agent
+  $>_ bottlenet --peers PEER1-IP:PORT,PEER2-IP:PORT
+
+In order to discover agents from DNS, e.g. a Kubernetes headless service
+
+  $>_ bottlenet --discover bottlenet.default.svc.cluster.local --min-peers 8
+  $>_ bottlenet --discover _bottlenet._tcp.bottlenet.default.svc.cluster.local
+
+In order to measure both directions of every pair and report asymmetric links and nodes
+
+  $>_ bottlenet --bidirectional
+
+In order to flood one node from 1, 2, 4... other nodes at once and find the
+fan-in level where its goodput collapses
+
+  $>_ bottlenet --pattern incast --target PEER-IP:PORT --size 64MiB --streams 8 --duration 10s
+
+In order to flood all the nodes of an erasure set from one node at once and
+check whether its uplink feeds them at line rate
+
+  $>_ bottlenet --pattern fanout --source PEER-IP:PORT --members set=1 --duration 10s
+
+In order to test only the pairs across two sites or pools, in both directions,
+start every node with the group it belongs to
+
+  $>_ bottlenet --pattern bipartite --group dc1
+  $>_ bottlenet --group dc1 CONTROL-SERVER-IP:PORT
+  $>_ bottlenet --group dc2 CONTROL-SERVER-IP:PORT
+
+Zeros are sent by default, which compressing VPNs and WAN optimizers shrink. In
+order to send incompressible data, data that compresses by half, or the content
+of a sample file
+
+  $>_ bottlenet --payload random
+  $>_ bottlenet --payload compressible --compressibility 0.5
+  $>_ bottlenet --payload file --payload-file object.bin
+
+In order to catch NICs, drivers or links that silently corrupt data, have the
+receivers verify a checksum of every 64 KiB block and report corrupted blocks
+per pair
+
+  $>_ bottlenet --verify --payload random
+
+In order to run a custom traffic matrix of named groups of nodes sending to
+each other in phases, with a given concurrency, payload size and duration
+
+  $>_ bottlenet --plan plan.json
+  $>_ cat plan.json
+  {
+    "groups": {
+      "clients": {"nodes": ["PEER1-IP:PORT", "PEER2-IP:PORT"]},
+      "servers": {"labels": {"rack": "r2"}}
+    },
+    "phases": [
+      {"name": "writes", "from": ["clients"], "to": ["servers"],
+       "concurrency": 4, "size": "16MiB", "duration": "30s"}
+    ]
+  }
+
+In order to retest a node or a pair, keep the coordinator running and merge
+fresh results into its last report
+
+  $>_ bottlenet --keep-alive
+  $>_ bottlenet retest --node PEER-IP:PORT
+
+In order to stop a run on the coordinator and all of its peers, press Ctrl-C on
+the coordinator or run the following command. A partial report is written.
+
+  $>_ bottlenet cancel --coordinator COORDINATOR-IP:PORT
 `,
 }
 
 var (
 	address = ":7007"
+	iface   = ""
+	network = ""
+
+	preferFamily = familyIPv4
+	dualStack    = false
+
+	labels     = []string{}
+	nodeLabels = map[string]string{}
+	rackLabel  = "rack"
+	zoneLabel  = "zone"
+
+	agentMode   = false
+	staticPeers = []string{}
+	peersFile   = ""
+
+	discover         = ""
+	discoverInterval = 30 * time.Second
+	dnsServer        = ""
+	minPeers         = 0
+
+	serialTests   = false
+	bidirectional = false
+	tuiMode       = false
+	keepAlive     = false
+
+	percentiles = []float64{}
+
+	patternSizeArg  = "64MiB"
+	patternSize     = int64(0)
+	patternStreams  = 8
+	patternDuration = 10 * time.Second
+
+	pattern      = patternMesh
+	target       = ""
+	source       = ""
+	members      = []string{}
+	memberLabels = map[string]string{}
+
+	group = ""
+
+	payloadPattern  = payload.Zeros
+	compressibility = 0.5
+	payloadFile     = ""
+	payloadOptions  = payload.Options{}
+	verifyData      = false
+
+	planFile        = ""
+	trafficPlanFile *trafficPlan
 )
 
 func init() {
 	bottlenetCmd.PersistentFlags().StringVarP(&address, "address", "a", address, "listen address")
+	bottlenetCmd.PersistentFlags().StringVarP(&iface, "interface", "i", iface, "advertise and send traffic from the address of this interface")
+	bottlenetCmd.PersistentFlags().StringVarP(&network, "network", "n", network, "advertise and send traffic from the local address in this CIDR")
+	bottlenetCmd.PersistentFlags().StringVar(&preferFamily, "prefer", preferFamily, "address family to advertise first, 'ipv4' or 'ipv6'")
+	bottlenetCmd.PersistentFlags().BoolVar(&dualStack, "dual-stack", dualStack, "test every pair over both IPv4 and IPv6")
+	bottlenetCmd.PersistentFlags().StringArrayVarP(&labels, "label", "l", labels, "label this node with key=value, may be repeated")
+	bottlenetCmd.PersistentFlags().BoolVar(&agentMode, "agent", agentMode, "serve tests for a coordinator started with --peers, without joining")
+	bottlenetCmd.PersistentFlags().StringSliceVar(&staticPeers, "peers", staticPeers, "comma separated agent addresses to run the tests on, without a join step")
+	bottlenetCmd.PersistentFlags().StringVar(&peersFile, "peers-file", peersFile, "file with one agent address per line, see --peers")
+	bottlenetCmd.PersistentFlags().StringVar(&discover, "discover", discover, "discover agents from the A/AAAA or, if it starts with '_', SRV records of this DNS name")
+	bottlenetCmd.PersistentFlags().DurationVar(&discoverInterval, "discover-interval", discoverInterval, "how often to refresh the records of --discover")
+	bottlenetCmd.PersistentFlags().StringVar(&dnsServer, "dns-server", dnsServer, "resolve --discover against this DNS server (IP:PORT) instead of the system resolver")
+	bottlenetCmd.PersistentFlags().IntVar(&minPeers, "min-peers", minPeers, "start the tests without a prompt once this many agents are discovered")
+	bottlenetCmd.PersistentFlags().BoolVar(&serialTests, "serial", serialTests, "test one pair at a time instead of rounds of disjoint pairs in parallel")
+	bottlenetCmd.PersistentFlags().StringVar(&pattern, "pattern", pattern, "test pattern, 'mesh' for every pair, 'incast' for many senders to one target, 'fanout' for one sender to many or 'bipartite' for pairs across two groups")
+	bottlenetCmd.PersistentFlags().StringVar(&planFile, "plan", planFile, "run the groups and phases of this JSON traffic plan instead of the mesh")
+	bottlenetCmd.PersistentFlags().StringVar(&target, "target", target, "receiver of the incast pattern (default: the coordinator)")
+	bottlenetCmd.PersistentFlags().StringVar(&patternSizeArg, "size", patternSizeArg, "payload of each request of the incast and fanout patterns, split across the pairs sharing a link")
+	bottlenetCmd.PersistentFlags().IntVar(&patternStreams, "streams", patternStreams, "parallel requests of each pair of the incast and fanout patterns")
+	bottlenetCmd.PersistentFlags().DurationVar(&patternDuration, "duration", patternDuration, "how long each pair of the incast and fanout patterns floods")
+	bottlenetCmd.PersistentFlags().StringVar(&source, "source", source, "sender of the fanout pattern (default: the coordinator)")
+	bottlenetCmd.PersistentFlags().StringArrayVar(&members, "members", members, "flood only the nodes labelled key=value in the fanout pattern, may be repeated")
+	bottlenetCmd.PersistentFlags().BoolVar(&bidirectional, "bidirectional", bidirectional, "test both directions of every pair, to detect asymmetric links and nodes")
+	bottlenetCmd.PersistentFlags().BoolVar(&keepAlive, "keep-alive", keepAlive, "keep the coordinator running after the report is saved, to serve retests")
+	bottlenetCmd.PersistentFlags().BoolVar(&tuiMode, "tui", tuiMode, "show a full-screen dashboard on the coordinator")
+	bottlenetCmd.PersistentFlags().StringVar(&group, "group", group, "site or pool of this node, for --pattern bipartite")
+	bottlenetCmd.PersistentFlags().StringVar(&rackLabel, "rack-label", rackLabel, "label key that names the rack of a node")
+	bottlenetCmd.PersistentFlags().StringVar(&zoneLabel, "zone-label", zoneLabel, "label key that names the zone of a node")
+	bottlenetCmd.PersistentFlags().StringVar(&payloadPattern, "payload", payloadPattern, "data to send, 'zeros', 'random' for incompressible data, 'compressible' or 'file'")
+	bottlenetCmd.PersistentFlags().Float64Var(&compressibility, "compressibility", compressibility, "fraction of the data that compresses away with --payload compressible")
+	bottlenetCmd.PersistentFlags().StringVar(&payloadFile, "payload-file", payloadFile, "repeat the first MiB of this file with --payload file")
+	bottlenetCmd.PersistentFlags().BoolVar(&verifyData, "verify", verifyData, "checksum every block sent and verify it on the receiver, to catch corrupted data")
+	bottlenetCmd.PersistentFlags().Float64SliceVar(&percentiles, "percentiles", percentiles, "comma separated percentiles to report in addition to p50, p90, p99 and p99.9")
 	// Turned-off for now
 	// bottlenetCmd.PersistentFlags().BoolVarP(&clientMode, "client", "c", clientMode, "run in client mode")
 	// bottlenetCmd.PersistentFlags().BoolVarP(&serverMode, "server", "s", serverMode, "run in server mode")
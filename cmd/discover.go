@@ -0,0 +1,219 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// resolver is the subset of net.Resolver used for peer discovery, so
+// that a stub can stand in for DNS
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newResolver() resolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return newDialer().DialContext(ctx, network, dnsServer)
+		},
+	}
+}
+
+// resolvePeers resolves name into agent addresses. Names starting with
+// an underscore, like _bottlenet._tcp.bottlenet.default.svc, are looked
+// up as SRV records; anything else as A/AAAA records, using the port in
+// name or else the port bottlenet listens on.
+func resolvePeers(ctx context.Context, r resolver, name string) ([]string, error) {
+	addrs := []string{}
+	if strings.HasPrefix(name, "_") {
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			addrs = append(addrs, net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+		}
+	} else {
+		host, port, err := net.SplitHostPort(name)
+		if err != nil {
+			host = name
+			_, port = listenHostPort()
+		}
+		ips, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// interfaceIPs lists the addresses of the interfaces of this node
+func interfaceIPs() ([]net.IP, error) {
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, inter := range interfaceAddrs {
+		ip, _, err := net.ParseCIDR(inter.String())
+		if err == nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// isLocalAddr reports whether addr points to this node, as the
+// coordinator usually resolves its own record as well. Host names,
+// like SRV targets, are resolved with r before comparing them to
+// the addresses in local.
+func isLocalAddr(ctx context.Context, r resolver, addr string, local []net.IP) (bool, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, err
+	}
+	if _, localPort := listenHostPort(); port != localPort {
+		return false, nil
+	}
+	ips := []net.IP{}
+	if ip := net.ParseIP(strings.Split(host, "%")[0]); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		ipAddrs, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return false, err
+		}
+		for _, ipAddr := range ipAddrs {
+			ips = append(ips, ipAddr.IP)
+		}
+	}
+	for _, ip := range ips {
+		for _, x := range local {
+			if x.Equal(ip) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// discoverPeers keeps the peer list in sync with the records of
+// --discover until ctx is done. Peers are not removed while tests run.
+func discoverPeers(ctx context.Context) {
+	r := newResolver()
+	started := false
+	for {
+		if err := refreshPeers(ctx, r); err != nil {
+			fmt.Printf("%s discovery: %v\n", warnText(dot), err)
+		}
+
+		nodeLock.Lock()
+		count := len(peers) - 1
+		nodeLock.Unlock()
+		if !started && minPeers > 0 && count >= minPeers {
+			started = true
+			fmt.Println("running bottlenet tests...")
+			go runTest()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(discoverInterval):
+		}
+	}
+}
+
+func refreshPeers(ctx context.Context, r resolver) error {
+	addrs, err := resolvePeers(ctx, r, discover)
+	if err != nil {
+		return err
+	}
+
+	local, err := interfaceIPs()
+	if err != nil {
+		return err
+	}
+	found := map[string]bool{}
+	for _, addr := range addrs {
+		isLocal, err := isLocalAddr(ctx, r, addr, local)
+		if err != nil {
+			// unresolvable targets are retried on the next refresh
+			continue
+		}
+		if !isLocal {
+			found[addr] = true
+		}
+	}
+
+	nodeLock.Lock()
+	known := map[string]*node{}
+	for _, p := range peers[1:] {
+		known[p.Addr] = p
+	}
+	nodeLock.Unlock()
+
+	changed := false
+	for addr := range found {
+		if _, ok := known[addr]; ok {
+			continue
+		}
+		n, err := doInfo(ctx, addr)
+		if err != nil {
+			// not ready yet, retried on the next refresh
+			continue
+		}
+		if err := addPeer(n); err != nil {
+			fmt.Printf("%s discovery: could not add peer %s: %v\n", warnText(dot), addr, err)
+			continue
+		}
+		changed = true
+	}
+	if atomic.LoadInt32(&testRunning) == 0 {
+		for addr, p := range known {
+			if !found[addr] {
+				removePeer(p)
+				changed = true
+			}
+		}
+	}
+
+	// with --min-peers the tests start on their own, without a prompt
+	if changed && minPeers == 0 {
+		peersChanged()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// stubResolver answers lookups from fixed records
+type stubResolver struct {
+	srv   map[string][]*net.SRV
+	hosts map[string][]net.IPAddr
+}
+
+func (r stubResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	srvs, ok := r.srv[name]
+	if !ok {
+		return "", nil, fmt.Errorf("no SRV records for %s", name)
+	}
+	return name, srvs, nil
+}
+
+func (r stubResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("no A/AAAA records for %s", host)
+	}
+	return ips, nil
+}
+
+func newStubResolver() stubResolver {
+	return stubResolver{
+		srv: map[string][]*net.SRV{
+			"_bottlenet._tcp.bottlenet.default.svc": {
+				{Target: "node-2.bottlenet.default.svc.", Port: 7007},
+				{Target: "node-1.bottlenet.default.svc.", Port: 7007},
+			},
+		},
+		hosts: map[string][]net.IPAddr{
+			"bottlenet.default.svc": {
+				{IP: net.ParseIP("10.0.0.2")},
+				{IP: net.ParseIP("10.0.0.1")},
+				{IP: net.ParseIP("fd00::1")},
+			},
+			"node-1.bottlenet.default.svc": {{IP: net.ParseIP("10.0.0.1")}},
+			"node-2.bottlenet.default.svc": {{IP: net.ParseIP("10.0.0.2")}},
+		},
+	}
+}
+
+func TestResolvePeers(t *testing.T) {
+	defer func(old string) { address = old }(address)
+	address = ":7007"
+
+	testCases := []struct {
+		name     string
+		expected []string
+	}{
+		{
+			name:     "bottlenet.default.svc",
+			expected: []string{"10.0.0.1:7007", "10.0.0.2:7007", "[fd00::1]:7007"},
+		},
+		{
+			name:     "bottlenet.default.svc:9000",
+			expected: []string{"10.0.0.1:9000", "10.0.0.2:9000", "[fd00::1]:9000"},
+		},
+		{
+			name: "_bottlenet._tcp.bottlenet.default.svc",
+			expected: []string{
+				"node-1.bottlenet.default.svc:7007",
+				"node-2.bottlenet.default.svc:7007",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addrs, err := resolvePeers(context.Background(), newStubResolver(), tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(addrs, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, addrs)
+			}
+		})
+	}
+
+	if _, err := resolvePeers(context.Background(), newStubResolver(), "_missing._tcp.svc"); err == nil {
+		t.Error("expected an error for a missing SRV record")
+	}
+}
+
+func TestIsLocalAddr(t *testing.T) {
+	defer func(old string) { address = old }(address)
+	address = ":7007"
+
+	local := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}
+	testCases := []struct {
+		addr     string
+		expected bool
+		err      bool
+	}{
+		{addr: "10.0.0.1:7007", expected: true},
+		{addr: "10.0.0.2:7007", expected: false},
+		{addr: "10.0.0.1:9000", expected: false},
+		{addr: "[fd00::1]:7007", expected: true},
+		{addr: "node-1.bottlenet.default.svc:7007", expected: true},
+		{addr: "node-2.bottlenet.default.svc:7007", expected: false},
+		{addr: "node-3.bottlenet.default.svc:7007", err: true},
+		{addr: "10.0.0.1", err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			isLocal, err := isLocalAddr(context.Background(), newStubResolver(), tc.addr, local)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isLocal != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, isLocal)
+			}
+		})
+	}
+}
+
+func TestDiscoverExcludesSelf(t *testing.T) {
+	defer func(old string) { address = old }(address)
+	address = ":7007"
+
+	r := newStubResolver()
+	local := []net.IP{net.ParseIP("10.0.0.1")}
+	for _, name := range []string{"bottlenet.default.svc", "_bottlenet._tcp.bottlenet.default.svc"} {
+		addrs, err := resolvePeers(context.Background(), r, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remotes := []string{}
+		for _, addr := range addrs {
+			isLocal, err := isLocalAddr(context.Background(), r, addr, local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isLocal {
+				remotes = append(remotes, addr)
+			}
+		}
+		for _, addr := range remotes {
+			if addr == "10.0.0.1:7007" || addr == "node-1.bottlenet.default.svc:7007" {
+				t.Errorf("%s: self %s not excluded", name, addr)
+			}
+		}
+		if len(remotes) != len(addrs)-1 {
+			t.Errorf("%s: expected %d remotes, got %v", name, len(addrs)-1, remotes)
+		}
+	}
+}
@@ -20,10 +20,15 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg/payload"
 )
 
 func bottlenetEntrypoint(ctx context.Context, args []string) error {
@@ -37,8 +42,17 @@ func bottlenetEntrypoint(ctx context.Context, args []string) error {
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		<-c
-		cancel()
+		for range c {
+			// let a running test write its partial report, exit on
+			// the next signal
+			if cancelRun() {
+				fmt.Println("cancelling bottlenet tests...")
+				continue
+			}
+			restoreTerminal()
+			cancel()
+			return
+		}
 	}()
 
 	if clientMode || serverMode {
@@ -50,6 +64,9 @@ func bottlenetEntrypoint(ctx context.Context, args []string) error {
 	netCtx, cancel := context.WithCancel(mainCtx)
 	defer cancel()
 
+	if agentMode {
+		return agent(netCtx)
+	}
 	if len(args) > 0 {
 		return peer(netCtx, args[0])
 	}
@@ -63,7 +80,70 @@ func validateArgs(args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("extra argument for mesh network. expected 1 argument only")
 	}
-	return nil
+	static := len(staticPeers) > 0 || peersFile != ""
+	if agentMode && (len(args) > 0 || static) {
+		return fmt.Errorf("--agent cannot be combined with a coordinator address or --peers")
+	}
+	if static && len(args) > 0 {
+		return fmt.Errorf("--peers cannot be combined with a coordinator address")
+	}
+	if discover != "" && (agentMode || static || len(args) > 0) {
+		return fmt.Errorf("--discover can only be used on the coordinator, without --peers")
+	}
+	if discoverInterval <= 0 {
+		return fmt.Errorf("--discover-interval must be positive")
+	}
+	if dnsServer != "" {
+		if err := validateHostPort(dnsServer); err != nil {
+			return fmt.Errorf("invalid --dns-server '%s': %v", dnsServer, err)
+		}
+	}
+	if err := validatePattern(); err != nil {
+		return err
+	}
+	for _, p := range percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("percentile '%v' out of range (0, 100]", p)
+		}
+	}
+	var err error
+	if nodeLabels, err = parseLabels(labels); err != nil {
+		return err
+	}
+	if payloadOptions, err = newPayloadOptions(); err != nil {
+		return err
+	}
+	return validateAddressSelection()
+}
+
+// payloadSampleMax is how much of --payload-file is sent to the senders
+// and repeated
+const payloadSampleMax = humanize.MiByte
+
+func newPayloadOptions() (payload.Options, error) {
+	opts := payload.Options{
+		Pattern: payloadPattern,
+	}
+	switch payloadPattern {
+	case payload.Compressible:
+		opts.Compressibility = compressibility
+	case payload.File:
+		if payloadFile == "" {
+			return opts, fmt.Errorf("--payload file expects a --payload-file")
+		}
+		f, err := os.Open(payloadFile)
+		if err != nil {
+			return opts, err
+		}
+		defer f.Close()
+		if opts.Sample, err = ioutil.ReadAll(io.LimitReader(f, payloadSampleMax)); err != nil {
+			return opts, err
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return opts, fmt.Errorf("invalid --payload: %v", err)
+	}
+	return opts, nil
 }
 
 func validateHostPort(addr string) error {
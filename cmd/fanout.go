@@ -0,0 +1,164 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// fanoutDestination is the throughput of one destination of a fan-out,
+// the bytes it received over the time the source flooded it
+type fanoutDestination struct {
+	Dst        string
+	Throughput float64
+	// TimedOut counts the requests that did not reach it in time
+	TimedOut int
+	Error    string `json:",omitempty"`
+}
+
+// fanoutReport is the outcome of the fan-out pattern
+type fanoutReport struct {
+	Source string
+	// Egress is what all destinations received from the source, over the
+	// span from the start of the first flood to the end of the last
+	Egress       float64
+	Destinations []fanoutDestination
+}
+
+// runFanout floods all the members, every other node unless --members
+// is set, from the source at the same time, as the shards of an
+// erasure-coded object are written to all the drives of a set at once.
+// The source is the coordinator unless --source is set.
+func runFanout(ctx context.Context, nodes []*node) (*fanoutReport, error) {
+	src := nodes[0]
+	if source != "" {
+		var err error
+		if src, err = findNode(nodes, source); err != nil {
+			return nil, err
+		}
+	}
+	dsts := []*node{}
+	for _, n := range selectMembers(nodes) {
+		if n != src {
+			dsts = append(dsts, n)
+		}
+	}
+	if len(dsts) == 0 {
+		return nil, fmt.Errorf("fan-out needs at least one member besides the source %s", src.Addr)
+	}
+
+	round := []pair{}
+	remotes := []*node{}
+	for _, dst := range dsts {
+		round = append(round, pair{src: src, dst: dst})
+		remotes = append(remotes, &node{
+			NodeType: dst.NodeType,
+			Addr:     dst.Addr,
+			AltAddr:  dst.AltAddr,
+		})
+	}
+
+	view, stop := observeRounds([][]pair{round})
+	defer stop()
+
+	view.startRound(1, len(round))
+	// all destinations are flooded at the same time for as long
+	opts := sharedOptions(len(round))
+	opts.Concurrent = true
+	err := doDispatch(ctx, src.Addr, opts, remotes, func(pr progress) {
+		// the source reports its own advertised address
+		pr.Src = src.Addr
+		view.update(pr)
+	})
+	for i, remote := range remotes {
+		perr := err
+		if perr == nil && remote.Error != "" {
+			perr = errors.New(remote.Error)
+		}
+		view.pairDone(src.Addr, dsts[i].Addr, remote, perr)
+	}
+	view.endRound()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	rep := &fanoutReport{Source: src.Addr}
+	var bytes int64
+	var first, last time.Time
+	for i, remote := range remotes {
+		d := fanoutDestination{
+			Dst:   dsts[i].Addr,
+			Error: remote.Error,
+		}
+		if err != nil {
+			// the source could not be reached or failed as a whole
+			d.Error = pairError(err)
+		}
+		for _, p := range remote.Perf {
+			if p.Sent == nil || p.Receiver == nil || !p.Sent.End.After(p.Sent.Start) {
+				continue
+			}
+			// the bytes of timed-out requests never made it
+			d.Throughput += float64(p.Receiver.Bytes) / p.Sent.End.Sub(p.Sent.Start).Seconds()
+			d.TimedOut += p.Receiver.TimedOut
+			bytes += p.Receiver.Bytes
+			if first.IsZero() || p.Sent.Start.Before(first) {
+				first = p.Sent.Start
+			}
+			if p.Sent.End.After(last) {
+				last = p.Sent.End
+			}
+		}
+		rep.Destinations = append(rep.Destinations, d)
+	}
+	// the source timed all the floods on its own clock
+	if last.After(first) {
+		rep.Egress = float64(bytes) / last.Sub(first).Seconds()
+	}
+	sort.Slice(rep.Destinations, func(i, j int) bool {
+		return rep.Destinations[i].Throughput < rep.Destinations[j].Throughput
+	})
+	return rep, nil
+}
+
+func printFanout(rep *fanoutReport) {
+	if rep == nil {
+		return
+	}
+	fmt.Printf("Fan-out from %s to %d node(s): %s/s egress\n", rep.Source, len(rep.Destinations),
+		humanize.IBytes(uint64(rep.Egress)))
+	fmt.Printf("Destinations, slowest first:\n")
+	for i, d := range rep.Destinations {
+		if d.Error != "" {
+			fmt.Printf("%s %d. %s : %s\n", warnText(dot), i+1, d.Dst, d.Error)
+			continue
+		}
+		if d.TimedOut > 0 {
+			fmt.Printf("%s %d. %s : %s/s, %d request(s) timed out\n", warnText(dot), i+1, d.Dst,
+				humanize.IBytes(uint64(d.Throughput)), d.TimedOut)
+			continue
+		}
+		fmt.Printf("%d. %s : %s/s\n", i+1, d.Dst, humanize.IBytes(uint64(d.Throughput)))
+	}
+}
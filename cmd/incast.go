@@ -0,0 +1,188 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg/perf"
+)
+
+// incastCollapseRatio is the fraction of the best goodput of the lower
+// fan-in levels under which the goodput is considered collapsed
+const incastCollapseRatio = 0.8
+
+// incastSender is the goodput the target received from one sender of an
+// incast level
+type incastSender struct {
+	Src        string
+	Throughput float64
+	// TimedOut counts the requests that did not reach the target in time
+	TimedOut int
+	Error    string `json:",omitempty"`
+}
+
+// incastLevel is one step of the incast sweep, in which Senders nodes
+// flood the target at the same time
+type incastLevel struct {
+	Senders int
+	// Size is the payload of each request of every sender
+	Size int64
+	// Throughput is what the target received from all senders, over
+	// the span from the first to the last byte
+	Throughput float64
+	// Latency is merged from the latencies of all senders
+	Latency   perf.Latency
+	PerSender []incastSender
+}
+
+// incastReport is the outcome of the incast pattern
+type incastReport struct {
+	Target string
+	Levels []incastLevel
+	// CollapseAt is the number of senders at which the goodput collapsed,
+	// 0 if it did not
+	CollapseAt int
+}
+
+// incastLevels doubles the number of senders up to all of them
+func incastLevels(senders int) []int {
+	levels := []int{}
+	for n := 1; n < senders; n *= 2 {
+		levels = append(levels, n)
+	}
+	if senders > 0 {
+		levels = append(levels, senders)
+	}
+	return levels
+}
+
+// runIncast floods the target, the coordinator unless --target is set,
+// from a growing number of the other nodes at the same time, as the
+// shards of an erasure-coded object are read from many nodes at once
+func runIncast(ctx context.Context, nodes []*node) (*incastReport, error) {
+	dst := nodes[0]
+	if target != "" {
+		var err error
+		if dst, err = findNode(nodes, target); err != nil {
+			return nil, err
+		}
+	}
+	senders := []*node{}
+	for _, n := range nodes {
+		if n != dst {
+			senders = append(senders, n)
+		}
+	}
+	if len(senders) == 0 {
+		return nil, fmt.Errorf("incast needs at least one node besides the target %s", dst.Addr)
+	}
+
+	rounds := [][]pair{}
+	for _, n := range incastLevels(len(senders)) {
+		round := []pair{}
+		for _, src := range senders[:n] {
+			round = append(round, pair{src: src, dst: dst})
+		}
+		rounds = append(rounds, round)
+	}
+
+	rep := &incastReport{Target: dst.Addr}
+	view, stop := observeRounds(rounds)
+	defer stop()
+
+	best := 0.0
+	for r, round := range rounds {
+		// all senders of a level flood at the same time for as long
+		opts := sharedOptions(len(round))
+		view.startRound(r+1, len(round))
+		remotes := runRound(ctx, view, opts, round)
+		view.endRound()
+		if ctx.Err() != nil {
+			return rep, ctx.Err()
+		}
+
+		level := incastLevel{Senders: len(round), Size: opts.Size}
+		latency := perf.Histogram{}
+		for i, remote := range remotes {
+			s := incastSender{
+				Src:   round[i].src.Addr,
+				Error: remote.Error,
+			}
+			for _, p := range remote.Perf {
+				if p.Receiver != nil {
+					s.Throughput += p.Receiver.Goodput
+					s.TimedOut += p.Receiver.TimedOut
+				}
+				if err := latency.Merge(&p.Histograms.Latency); err != nil {
+					return rep, err
+				}
+			}
+			level.PerSender = append(level.PerSender, s)
+		}
+		// the target counted all the bytes on its own clock
+		if bytes, first, last := receivedWindow(remotes); last.After(first) {
+			level.Throughput = float64(bytes) / last.Sub(first).Seconds()
+		}
+		level.Latency = latency.Latency(percentiles...)
+		rep.Levels = append(rep.Levels, level)
+
+		// failed senders count as sending nothing
+		if rep.CollapseAt == 0 && r > 0 && level.Throughput < incastCollapseRatio*best {
+			rep.CollapseAt = level.Senders
+		}
+		if level.Throughput > best {
+			best = level.Throughput
+		}
+	}
+	return rep, nil
+}
+
+func printIncast(rep *incastReport) {
+	if rep == nil {
+		return
+	}
+	fmt.Printf("Incast into %s:\n", rep.Target)
+	for _, l := range rep.Levels {
+		failed, timedOut := 0, 0
+		for _, s := range l.PerSender {
+			if s.Error != "" {
+				failed++
+			}
+			timedOut += s.TimedOut
+		}
+		line := fmt.Sprintf("  %3d sender(s) of %s: %s/s, p99 latency %.3fs", l.Senders,
+			humanize.IBytes(uint64(l.Size)), humanize.IBytes(uint64(l.Throughput)), l.Latency.Percentile99)
+		if timedOut > 0 {
+			line += fmt.Sprintf(", %d request(s) timed out", timedOut)
+		}
+		if failed > 0 {
+			line += fmt.Sprintf(", %d failed", failed)
+		}
+		fmt.Println(line)
+	}
+	if rep.CollapseAt > 0 {
+		fmt.Printf("%s Goodput collapsed at %d senders.\n", warnText(dot), rep.CollapseAt)
+		return
+	}
+	if n := len(rep.Levels); n > 0 {
+		fmt.Printf("No goodput collapse up to %d senders.\n", rep.Levels[n-1].Senders)
+	}
+}
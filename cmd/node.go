@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/minio/bottlenet/pkg"
+	"github.com/minio/bottlenet/pkg/analysis"
 	"github.com/minio/bottlenet/pkg/perf"
 )
 
@@ -48,7 +50,62 @@ const (
 type node struct {
 	NodeType nodeType
 	Addr     string
-	Perf     map[string]perf.Perf
+	// AltAddr is the address of the node in the other IP family,
+	// set only for dual-stack tests
+	AltAddr string            `json:",omitempty"`
+	Version string            `json:",omitempty"`
+	Host    *hostInfo         `json:",omitempty"`
+	Labels  map[string]string `json:",omitempty"`
+	// Group is the site or pool of the node, for bipartite tests
+	Group string `json:",omitempty"`
+	Perf  map[string]perf.Perf
+	// Error is set if the pair could not be tested
+	Error string `json:",omitempty"`
+	// Retested marks results that were measured again after the run
+	Retested bool `json:",omitempty"`
+}
+
+// newSelfNode describes this node as it is advertised to the coordinator
+func newSelfNode(t nodeType) *node {
+	addr := getLocalIPs()[0]
+	return &node{
+		NodeType: t,
+		Addr:     addr,
+		AltAddr:  getAltLocalIP(),
+		Version:  pkg.Version,
+		Host:     getHostInfo(addr),
+		Labels:   nodeLabels,
+		Group:    group,
+	}
+}
+
+// report is the consolidated output of a bottlenet run
+type report struct {
+	// Nodes holds the metadata of every node, keyed by address
+	Nodes map[string]*node
+	// Results holds, for each sender, the remotes it tested
+	Results map[string][]*node
+	// Aggregate summarizes results by rack and zone labels
+	Aggregate *labelAggregate `json:",omitempty"`
+	// Percentiles are merged from the histograms of every pair
+	Percentiles *clusterPercentiles `json:",omitempty"`
+	// Attribution tells slow nodes from slow links
+	Attribution *analysis.Attribution `json:",omitempty"`
+	// Asymmetry compares the directions of the pairs measured both ways
+	Asymmetry *analysis.Asymmetry `json:",omitempty"`
+	// DualStack compares the families of the pairs tested over both
+	DualStack []dualStackPair `json:",omitempty"`
+	// Incast is the outcome of the incast pattern
+	Incast *incastReport `json:",omitempty"`
+	// Fanout is the outcome of the fan-out pattern
+	Fanout *fanoutReport `json:",omitempty"`
+	// Plan is the outcome of the phases of --plan
+	Plan *planReport `json:",omitempty"`
+	// Bipartite summarizes the traffic between the two groups
+	Bipartite *bipartiteReport `json:",omitempty"`
+	// Status is "cancelled" if the run was stopped before every pair
+	// was tested
+	Status string `json:",omitempty"`
 }
 
 type clusterType int
@@ -81,13 +138,21 @@ func addPeer(p *node) error {
 	if p.Addr == "" {
 		return fmt.Errorf("peer addr cannot be empty")
 	}
+	if p.Version != pkg.Version {
+		return fmt.Errorf("peer runs bottlenet version '%s', expected '%s'", p.Version, pkg.Version)
+	}
 
 	nodeLock.Lock()
+	defer nodeLock.Unlock()
 
+	// the pairs and the results are keyed by address
+	for _, x := range peers {
+		if x.Addr == p.Addr {
+			return fmt.Errorf("peer %s already joined", p.Addr)
+		}
+	}
 	peers = append(peers, p)
 
-	nodeLock.Unlock()
-
 	return nil
 }
 
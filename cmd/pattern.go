@@ -0,0 +1,181 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	patternMesh      = "mesh"
+	patternIncast    = "incast"
+	patternFanout    = "fanout"
+	patternPlan      = "plan"
+	patternBipartite = "bipartite"
+)
+
+// patterns are the test plans the coordinator can run, mesh being the
+// default one of every pair in rounds
+var patterns = []string{patternMesh, patternIncast, patternFanout, patternPlan, patternBipartite}
+
+func validatePattern() error {
+	valid := false
+	for _, p := range patterns {
+		valid = valid || p == pattern
+	}
+	if !valid {
+		return fmt.Errorf("unknown --pattern '%s', expected one of %s", pattern, strings.Join(patterns, ", "))
+	}
+	if planFile != "" {
+		if pattern != patternMesh && pattern != patternPlan {
+			return fmt.Errorf("--plan cannot be used with --pattern %s", pattern)
+		}
+		pattern = patternPlan
+		var err error
+		if trafficPlanFile, err = loadPlan(planFile); err != nil {
+			return err
+		}
+	} else if pattern == patternPlan {
+		return fmt.Errorf("--pattern plan expects a --plan file")
+	}
+	if pattern == patternBipartite && group == "" {
+		return fmt.Errorf("--pattern bipartite expects the --group of this node")
+	}
+	if pattern != patternMesh && (clientMode || serverMode) {
+		return fmt.Errorf("--pattern %s cannot be used in client-server mode", pattern)
+	}
+	if target != "" {
+		if err := validateHostPort(target); err != nil {
+			return fmt.Errorf("invalid --target '%s': %v", target, err)
+		}
+	}
+	if source != "" {
+		if err := validateHostPort(source); err != nil {
+			return fmt.Errorf("invalid --source '%s': %v", source, err)
+		}
+	}
+	size, err := humanize.ParseBytes(patternSizeArg)
+	if err != nil || size == 0 {
+		return fmt.Errorf("invalid --size '%s'", patternSizeArg)
+	}
+	patternSize = int64(size)
+	if patternStreams <= 0 {
+		return fmt.Errorf("--streams must be positive")
+	}
+	if patternDuration <= 0 {
+		return fmt.Errorf("--duration must be positive")
+	}
+	memberLabels, err = parseLabels(members)
+	return err
+}
+
+// patternOptions floods every pair of a pattern with the same size,
+// streams and duration, so that the pairs tested together overlap for
+// the whole test instead of stepping down each on its own
+func patternOptions() testOptions {
+	opts := newTestOptions()
+	opts.Size = patternSize
+	opts.Streams = patternStreams
+	opts.Duration = patternDuration
+	return opts
+}
+
+// minSharedSize is the smallest request sharedOptions splits --size into
+const minSharedSize = humanize.MiByte
+
+// sharedOptions are the patternOptions of pairs floods sharing a link at
+// once. --size is split across them, so that the link carries as much
+// at once, and its requests take as long, whatever the number of pairs.
+func sharedOptions(pairs int) testOptions {
+	opts := patternOptions()
+	size := opts.Size / int64(pairs)
+	if size < minSharedSize {
+		size = minSharedSize
+	}
+	if size < opts.Size {
+		opts.Size = size
+	}
+	return opts
+}
+
+// receivedWindow adds up the bytes the receivers of remotes counted and
+// spans the first to the last of them. The times are only comparable
+// if a single node received them all.
+func receivedWindow(remotes []*node) (bytes int64, first, last time.Time) {
+	for _, remote := range remotes {
+		for _, p := range remote.Perf {
+			if p.Receiver == nil || p.Receiver.FirstByte.IsZero() {
+				continue
+			}
+			bytes += p.Receiver.Bytes
+			if first.IsZero() || p.Receiver.FirstByte.Before(first) {
+				first = p.Receiver.FirstByte
+			}
+			if p.Receiver.LastByte.After(last) {
+				last = p.Receiver.LastByte
+			}
+		}
+	}
+	return bytes, first, last
+}
+
+// selectMembers returns the nodes carrying all the labels of --members
+func selectMembers(nodes []*node) []*node {
+	selected := []*node{}
+	for _, n := range nodes {
+		match := true
+		for k, v := range memberLabels {
+			match = match && n.Labels[k] == v
+		}
+		if match {
+			selected = append(selected, n)
+		}
+	}
+	return selected
+}
+
+// findNode returns the node of nodes joined with addr
+func findNode(nodes []*node, addr string) (*node, error) {
+	for _, n := range nodes {
+		if n.Addr == addr || (n.AltAddr != "" && n.AltAddr == addr) {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("node '%s' has not joined", addr)
+}
+
+// runPattern runs the pattern selected with --pattern, other than mesh,
+// and adds its outcome to rep
+func runPattern(ctx context.Context, nodes []*node, rep *report) (err error) {
+	switch pattern {
+	case patternIncast:
+		rep.Incast, err = runIncast(ctx, nodes)
+	case patternFanout:
+		rep.Fanout, err = runFanout(ctx, nodes)
+	case patternPlan:
+		rep.Plan, err = runPlan(ctx, nodes)
+	case patternBipartite:
+		err = runBipartite(ctx, nodes, rep)
+	}
+	return err
+}
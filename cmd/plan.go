@@ -0,0 +1,347 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// trafficPlan describes a custom test plan, read from the JSON file of
+// --plan. Named groups of nodes send to each other in phases run one
+// after the other, see the help for an example.
+type trafficPlan struct {
+	Groups map[string]planGroup
+	Phases []planPhase
+}
+
+// planGroup selects nodes by address, by labels, or both
+type planGroup struct {
+	Nodes  []string          `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+}
+
+// planPhase floods every node of the To groups from every node of the
+// From groups, all flows at the same time. Concurrency, Size and
+// Duration are optional, the defaults step down from 100 Gbit like the
+// mesh does.
+type planPhase struct {
+	Name string
+	From []string
+	To   []string
+	// Concurrency is the number of parallel requests of each flow
+	Concurrency int `json:",omitempty"`
+	// Size is the payload of each request, e.g. "64MiB"
+	Size string `json:",omitempty"`
+	// Duration of the floods, e.g. "30s"
+	Duration string `json:",omitempty"`
+}
+
+// planFlow is the throughput of a flow of a phase
+type planFlow struct {
+	Src        string
+	Dst        string
+	Throughput float64
+	Error      string `json:",omitempty"`
+}
+
+// planPhaseReport is the outcome of a phase
+type planPhaseReport struct {
+	Name string
+	// Throughput is the sum of the throughput of all flows
+	Throughput float64
+	Flows      []planFlow
+}
+
+// planReport is the outcome of a --plan run
+type planReport struct {
+	File   string
+	Phases []planPhaseReport
+}
+
+// loadPlan reads and checks the plan file, leaving the nodes to be
+// resolved once the peers have joined
+func loadPlan(filename string) (*trafficPlan, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	plan := &trafficPlan{}
+	if err := json.Unmarshal(b, plan); err != nil {
+		return nil, fmt.Errorf("invalid plan '%s': %v", filename, err)
+	}
+	if len(plan.Phases) == 0 {
+		return nil, fmt.Errorf("invalid plan '%s': no phases", filename)
+	}
+	for name, g := range plan.Groups {
+		if len(g.Nodes) == 0 && len(g.Labels) == 0 {
+			return nil, fmt.Errorf("invalid plan '%s': group '%s' selects no nodes", filename, name)
+		}
+		for _, addr := range g.Nodes {
+			if err := validateHostPort(addr); err != nil {
+				return nil, fmt.Errorf("invalid plan '%s': group '%s': invalid node '%s': %v", filename, name, addr, err)
+			}
+		}
+	}
+	for i, ph := range plan.Phases {
+		if ph.Name == "" {
+			plan.Phases[i].Name = fmt.Sprintf("phase %d", i+1)
+		}
+		if _, err := phaseOptions(ph); err != nil {
+			return nil, fmt.Errorf("invalid plan '%s': %s: %v", filename, plan.Phases[i].Name, err)
+		}
+		if len(ph.From) == 0 || len(ph.To) == 0 {
+			return nil, fmt.Errorf("invalid plan '%s': %s: expected groups to send from and to", filename, plan.Phases[i].Name)
+		}
+		for _, g := range append(append([]string{}, ph.From...), ph.To...) {
+			if _, ok := plan.Groups[g]; !ok {
+				return nil, fmt.Errorf("invalid plan '%s': %s: unknown group '%s'", filename, plan.Phases[i].Name, g)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// phaseOptions turns the settings of a phase into the options sent to
+// its senders
+func phaseOptions(ph planPhase) (testOptions, error) {
+	opts := newTestOptions()
+	opts.Concurrent = true
+	if ph.Concurrency < 0 {
+		return opts, fmt.Errorf("invalid concurrency '%d'", ph.Concurrency)
+	}
+	opts.Streams = ph.Concurrency
+	if ph.Size != "" {
+		size, err := humanize.ParseBytes(ph.Size)
+		if err != nil || size == 0 {
+			return opts, fmt.Errorf("invalid size '%s'", ph.Size)
+		}
+		opts.Size = int64(size)
+	}
+	if ph.Duration != "" {
+		d, err := time.ParseDuration(ph.Duration)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid duration '%s'", ph.Duration)
+		}
+		opts.Duration = d
+	}
+	return opts, nil
+}
+
+// resolveGroup returns the joined nodes of a group
+func resolveGroup(nodes []*node, name string, g planGroup) ([]*node, error) {
+	selected := []*node{}
+	seen := map[*node]bool{}
+	add := func(n *node) {
+		if !seen[n] {
+			seen[n] = true
+			selected = append(selected, n)
+		}
+	}
+	for _, addr := range g.Nodes {
+		n, err := findNode(nodes, addr)
+		if err != nil {
+			return nil, fmt.Errorf("group '%s': %v", name, err)
+		}
+		add(n)
+	}
+	if len(g.Labels) > 0 {
+		for _, n := range nodes {
+			match := true
+			for k, v := range g.Labels {
+				match = match && n.Labels[k] == v
+			}
+			if match {
+				add(n)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("group '%s' matches no joined node", name)
+	}
+	return selected, nil
+}
+
+// phaseRound resolves the flows of a phase, skipping nodes sending to
+// themselves
+func phaseRound(nodes []*node, plan *trafficPlan, ph planPhase) ([]pair, error) {
+	resolve := func(groups []string) ([]*node, error) {
+		res := []*node{}
+		seen := map[*node]bool{}
+		for _, name := range groups {
+			members, err := resolveGroup(nodes, name, plan.Groups[name])
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range members {
+				if !seen[n] {
+					seen[n] = true
+					res = append(res, n)
+				}
+			}
+		}
+		return res, nil
+	}
+	srcs, err := resolve(ph.From)
+	if err != nil {
+		return nil, err
+	}
+	dsts, err := resolve(ph.To)
+	if err != nil {
+		return nil, err
+	}
+	round := []pair{}
+	for _, src := range srcs {
+		for _, dst := range dsts {
+			if src != dst {
+				round = append(round, pair{src: src, dst: dst})
+			}
+		}
+	}
+	if len(round) == 0 {
+		return nil, fmt.Errorf("%s has no flows", ph.Name)
+	}
+	return round, nil
+}
+
+// runPlan validates the plan against the joined nodes and runs its phases
+// one after the other
+func runPlan(ctx context.Context, nodes []*node) (*planReport, error) {
+	rounds := [][]pair{}
+	for _, ph := range trafficPlanFile.Phases {
+		round, err := phaseRound(nodes, trafficPlanFile, ph)
+		if err != nil {
+			return nil, err
+		}
+		rounds = append(rounds, round)
+	}
+
+	view, stop := observeRounds(rounds)
+	defer stop()
+
+	rep := &planReport{File: planFile}
+	for r, round := range rounds {
+		ph := trafficPlanFile.Phases[r]
+		opts, err := phaseOptions(ph)
+		if err != nil {
+			return nil, err
+		}
+
+		view.startRound(r+1, len(round))
+		flows := runPhase(ctx, view, opts, round)
+		view.endRound()
+		if ctx.Err() != nil {
+			return rep, ctx.Err()
+		}
+
+		phase := planPhaseReport{Name: ph.Name, Flows: flows}
+		for _, f := range flows {
+			phase.Throughput += f.Throughput
+		}
+		rep.Phases = append(rep.Phases, phase)
+	}
+	return rep, nil
+}
+
+// runPhase dispatches the flows of each sender of a round at once, all
+// senders at the same time
+func runPhase(ctx context.Context, view runObserver, opts testOptions, round []pair) []planFlow {
+	bySrc := map[*node][]*node{}
+	srcs := []*node{}
+	for _, p := range round {
+		if _, ok := bySrc[p.src]; !ok {
+			srcs = append(srcs, p.src)
+		}
+		bySrc[p.src] = append(bySrc[p.src], p.dst)
+	}
+
+	mu := sync.Mutex{}
+	flows := []planFlow{}
+	wg := sync.WaitGroup{}
+	for _, src := range srcs {
+		wg.Add(1)
+		go func(src *node, dsts []*node) {
+			defer wg.Done()
+			remotes := []*node{}
+			for _, dst := range dsts {
+				remotes = append(remotes, &node{
+					NodeType: dst.NodeType,
+					Addr:     dst.Addr,
+					AltAddr:  dst.AltAddr,
+				})
+			}
+			err := doDispatch(ctx, src.Addr, opts, remotes, func(pr progress) {
+				// senders report their own advertised address
+				pr.Src = src.Addr
+				view.update(pr)
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			for i, remote := range remotes {
+				perr := err
+				if perr == nil && remote.Error != "" {
+					perr = errors.New(remote.Error)
+				}
+				view.pairDone(src.Addr, dsts[i].Addr, remote, perr)
+				f := planFlow{
+					Src:   src.Addr,
+					Dst:   dsts[i].Addr,
+					Error: remote.Error,
+				}
+				if err != nil {
+					f.Error = pairError(err)
+				}
+				for _, p := range remote.Perf {
+					f.Throughput += p.Throughput.Avg
+				}
+				flows = append(flows, f)
+			}
+		}(src, bySrc[src])
+	}
+	wg.Wait()
+
+	sort.Slice(flows, func(i, j int) bool {
+		return pairKey(flows[i].Src, flows[i].Dst) < pairKey(flows[j].Src, flows[j].Dst)
+	})
+	return flows
+}
+
+func printPlan(rep *planReport) {
+	if rep == nil {
+		return
+	}
+	fmt.Printf("Plan %s:\n", rep.File)
+	for _, ph := range rep.Phases {
+		fmt.Printf("  %s: %s/s over %d flow(s)\n", ph.Name, humanize.IBytes(uint64(ph.Throughput)), len(ph.Flows))
+		for _, f := range ph.Flows {
+			if f.Error != "" {
+				fmt.Printf("  %s %s : %s\n", warnText(dot), pairKey(f.Src, f.Dst), f.Error)
+				continue
+			}
+			fmt.Printf("    %s : %s/s\n", pairKey(f.Src, f.Dst), humanize.IBytes(uint64(f.Throughput)))
+		}
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-isatty"
+	"github.com/minio/minio/pkg/console"
+)
+
+// progress is a snapshot of a running test, streamed from the sender
+// to the coordinator while the test runs
+type progress struct {
+	Src   string
+	Dst   string
+	Step  int
+	Steps int
+	Bytes int64
+}
+
+// progressTracker collects the progress of a single test on the sender
+type progressTracker struct {
+	src   string
+	dst   string
+	step  int32
+	steps int32
+	bytes int64
+}
+
+func newProgressTracker(src, dst string) *progressTracker {
+	return &progressTracker{
+		src: src,
+		dst: dst,
+	}
+}
+
+func (t *progressTracker) setStep(step, steps int) {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt32(&t.step, int32(step))
+	atomic.StoreInt32(&t.steps, int32(steps))
+}
+
+func (t *progressTracker) addBytes(n int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.bytes, n)
+}
+
+func (t *progressTracker) snapshot() progress {
+	return progress{
+		Src:   t.src,
+		Dst:   t.dst,
+		Step:  int(atomic.LoadInt32(&t.step)),
+		Steps: int(atomic.LoadInt32(&t.steps)),
+		Bytes: atomic.LoadInt64(&t.bytes),
+	}
+}
+
+// runObserver follows the rounds of a run on the coordinator
+type runObserver interface {
+	startRound(round, pairs int)
+	update(p progress)
+	pairDone(src, dst string, remote *node, err error)
+	endRound()
+	tick()
+}
+
+func newRunObserver(rounds [][]pair) runObserver {
+	if dash != nil {
+		dash.reset(rounds)
+		return dash
+	}
+	return newProgressView(rounds)
+}
+
+// plainProgressInterval is how often running tests are reported when
+// stdout is not a terminal
+const plainProgressInterval = 10 * time.Second
+
+// progressView renders the progress of a run on the coordinator. On a
+// terminal it redraws a few lines in place, otherwise it prints plain
+// lines that are safe to pipe into a log.
+type progressView struct {
+	mu sync.Mutex
+
+	tty bool
+	// silent suppresses all output, for when another view draws
+	silent    bool
+	lines     int
+	lastPlain time.Time
+
+	start      time.Time
+	roundStart time.Time
+	round      int
+	rounds     int
+	roundsDone int
+	pairs      int
+	pairsDone  int
+	active     map[string]progress
+}
+
+func newProgressView(rounds [][]pair) *progressView {
+	pairs := 0
+	for _, round := range rounds {
+		pairs += len(round)
+	}
+	return &progressView{
+		tty:    isatty.IsTerminal(os.Stdout.Fd()),
+		start:  time.Now(),
+		rounds: len(rounds),
+		pairs:  pairs,
+		active: map[string]progress{},
+	}
+}
+
+func pairKey(src, dst string) string {
+	return src + " -> " + dst
+}
+
+func (v *progressView) startRound(round, pairs int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.round = round
+	v.roundStart = time.Now()
+	if !v.tty && !v.silent {
+		fmt.Printf("round %d/%d: testing %d pair(s)...\n", round, v.rounds, pairs)
+	}
+	v.render()
+}
+
+func (v *progressView) update(p progress) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.active[pairKey(p.Src, p.Dst)] = p
+}
+
+func (v *progressView) pairDone(src, dst string, remote *node, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.active, pairKey(src, dst))
+	v.pairsDone++
+	if !v.tty && !v.silent {
+		status := "done"
+		if err != nil {
+			status = err.Error()
+		}
+		fmt.Printf("[%d/%d] %s: %s\n", v.pairsDone, v.pairs, pairKey(src, dst), status)
+	}
+	v.render()
+}
+
+func (v *progressView) endRound() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.roundsDone++
+	if !v.tty && !v.silent {
+		fmt.Printf("round %d/%d: done in %s, ETA %s\n", v.round, v.rounds,
+			time.Since(v.roundStart).Round(time.Second), v.eta())
+	}
+	v.render()
+}
+
+// tick redraws the terminal, or periodically prints the running tests
+// when stdout is not a terminal
+func (v *progressView) tick() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.silent {
+		return
+	}
+	if v.tty {
+		v.render()
+		return
+	}
+	if time.Since(v.lastPlain) < plainProgressInterval {
+		return
+	}
+	v.lastPlain = time.Now()
+	for _, p := range v.sortedActive() {
+		fmt.Println(v.activeLine(p))
+	}
+}
+
+// eta extrapolates the average duration of the finished rounds
+func (v *progressView) eta() string {
+	if v.roundsDone == 0 {
+		return "unknown"
+	}
+	elapsed := time.Since(v.start)
+	if v.roundsDone < v.round {
+		elapsed -= time.Since(v.roundStart)
+	}
+	perRound := elapsed / time.Duration(v.roundsDone)
+	eta := perRound * time.Duration(v.rounds-v.roundsDone)
+	if v.roundsDone < v.round {
+		eta -= time.Since(v.roundStart)
+	}
+	if eta < 0 {
+		eta = 0
+	}
+	return eta.Round(time.Second).String()
+}
+
+func (v *progressView) sortedActive() []progress {
+	active := []progress{}
+	for _, p := range v.active {
+		active = append(active, p)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return pairKey(active[i].Src, active[i].Dst) < pairKey(active[j].Src, active[j].Dst)
+	})
+	return active
+}
+
+func (v *progressView) activeLine(p progress) string {
+	return fmt.Sprintf("  %s  step %d/%d  %s", pairKey(p.Src, p.Dst), p.Step, p.Steps, humanize.IBytes(uint64(p.Bytes)))
+}
+
+func (v *progressView) render() {
+	if !v.tty || v.silent {
+		return
+	}
+	console.RewindLines(v.lines)
+
+	fmt.Printf("%s round %d/%d  pairs %d/%d  elapsed %s  ETA %s\n", infoText(dot),
+		v.round, v.rounds, v.pairsDone, v.pairs,
+		time.Since(v.start).Round(time.Second), v.eta())
+	active := v.sortedActive()
+	for _, p := range active {
+		fmt.Println(v.activeLine(p))
+	}
+	v.lines = 1 + len(active)
+}
@@ -0,0 +1,293 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lastReport     *report
+	lastReportFile string
+	reportLock     sync.Mutex
+)
+
+// storeReport remembers the report of the last run so that retests can
+// be merged into it
+func storeReport(rep report, filename string) {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	lastReport = &rep
+	lastReportFile = filename
+}
+
+// retestRequest asks the coordinator to test a single node or a few
+// pairs again. Pairs are given as [SRC, DST].
+type retestRequest struct {
+	Node  string     `json:",omitempty"`
+	Pairs [][]string `json:",omitempty"`
+}
+
+// retestResponse carries the report with the retested entries merged
+type retestResponse struct {
+	File   string
+	Report report
+}
+
+// retestPairs resolves the pairs of req against the last report. A node
+// is retested in every pair it was measured in, in the same direction.
+func retestPairs(rep *report, req retestRequest) ([]pair, error) {
+	lookup := func(addr string) (*node, error) {
+		n, ok := rep.Nodes[addr]
+		if !ok {
+			return nil, fmt.Errorf("node '%s' is not part of the last report", addr)
+		}
+		return n, nil
+	}
+
+	pairs := []pair{}
+	if req.Node != "" {
+		if _, err := lookup(req.Node); err != nil {
+			return nil, err
+		}
+		for src, remotes := range rep.Results {
+			for _, remote := range remotes {
+				if src != req.Node && remote.Addr != req.Node {
+					continue
+				}
+				pairs = append(pairs, pair{src: rep.Nodes[src], dst: rep.Nodes[remote.Addr]})
+			}
+		}
+		if len(pairs) == 0 {
+			return nil, fmt.Errorf("node '%s' was not tested in the last report", req.Node)
+		}
+	}
+	for _, p := range req.Pairs {
+		if len(p) != 2 || p[0] == p[1] {
+			return nil, fmt.Errorf("invalid pair '%s', expected SRC,DST", strings.Join(p, ","))
+		}
+		src, err := lookup(p[0])
+		if err != nil {
+			return nil, err
+		}
+		dst, err := lookup(p[1])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{src: src, dst: dst})
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("nothing to retest, expected a node or a pair")
+	}
+	return pairs, nil
+}
+
+// mergeRetest replaces the entries of rep with the fresh results and
+// marks them as retested
+func mergeRetest(rep *report, results map[string][]*node) error {
+	for src, remotes := range results {
+		for _, remote := range remotes {
+			remote.Retested = true
+			replaced := false
+			for i, old := range rep.Results[src] {
+				if old.Addr == remote.Addr {
+					rep.Results[src][i] = remote
+					replaced = true
+				}
+			}
+			if !replaced {
+				rep.Results[src] = append(rep.Results[src], remote)
+			}
+		}
+	}
+	return summarizeReport(rep)
+}
+
+// retest runs the pairs of req one after the other and merges the
+// results into the last report, rewriting its file
+func retest(ctx context.Context, req retestRequest) (retestResponse, error) {
+	if !atomic.CompareAndSwapInt32(&testRunning, 0, 1) {
+		return retestResponse{}, fmt.Errorf("tests are running, retry once they finish")
+	}
+	defer atomic.StoreInt32(&testRunning, 0)
+
+	reportLock.Lock()
+	rep := lastReport
+	reportLock.Unlock()
+	if rep == nil {
+		return retestResponse{}, fmt.Errorf("no report to retest yet, run the tests first")
+	}
+
+	pairs, err := retestPairs(rep, req)
+	if err != nil {
+		return retestResponse{}, err
+	}
+
+	results, err := runRounds(ctx, serialRounds([][]pair{pairs}))
+	if err != nil {
+		return retestResponse{}, err
+	}
+
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	if err := mergeRetest(rep, results); err != nil {
+		return retestResponse{}, err
+	}
+	if err := writeReport(*rep, lastReportFile); err != nil {
+		return retestResponse{}, err
+	}
+	return retestResponse{
+		File:   lastReportFile,
+		Report: *rep,
+	}, nil
+}
+
+func listenRetest(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := retestRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := retest(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respBody, err := json.MarshalIndent(resp, "", " ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(respBody)
+}
+
+func doRetest(ctx context.Context, coordinator string, req retestRequest) (retestResponse, error) {
+	client := newClient()
+	resp := retestResponse{}
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		bottlenetURL(coordinator, "retest"), bytes.NewReader(reqBody))
+	if err != nil {
+		return resp, err
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf(strings.TrimSpace(string(respBody)))
+	}
+	err = json.Unmarshal(respBody, &resp)
+	return resp, err
+}
+
+var (
+	retestNode        = ""
+	retestPairArgs    = []string{}
+	retestCoordinator = ""
+)
+
+var retestCmd = &cobra.Command{
+	Use:   "retest [--node ADDR] [--pair SRC,DST...]",
+	Short: "Retest a node or pairs on a running coordinator and merge the results into its last report",
+	Long: `
+Retest a single node or a few pairs on a coordinator that is still running,
+started with --keep-alive or --tui, and merge the fresh results into its last
+report. Retested entries are marked in the report.
+
+  $>_ bottlenet retest --node PEER-IP:PORT
+  $>_ bottlenet retest --pair SRC-IP:PORT,DST-IP:PORT
+`,
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	SilenceUsage:          true,
+	SilenceErrors:         true,
+	RunE: func(c *cobra.Command, args []string) error {
+		req := retestRequest{
+			Node: retestNode,
+		}
+		for _, p := range retestPairArgs {
+			req.Pairs = append(req.Pairs, strings.Split(p, ","))
+		}
+		coordinator := retestCoordinator
+		if coordinator == "" {
+			coordinator = getLocalIPs()[0]
+		}
+
+		resp, err := doRetest(context.Background(), coordinator, req)
+		if err != nil {
+			return err
+		}
+		for _, e := range reportEdges(resp.Report) {
+			if !e.Retested {
+				continue
+			}
+			fmt.Printf("%s %s : %s/s (%s/s per stream)\n", infoText(dot), e.key(),
+				humanize.IBytes(uint64(e.Perf.Throughput.Avg)), humanize.IBytes(uint64(e.Perf.StreamThroughput.Avg)))
+		}
+		failed := false
+		for src, remotes := range resp.Report.Results {
+			for _, remote := range remotes {
+				if remote.Retested && remote.Error != "" {
+					fmt.Printf("%s %s : %s\n", warnText(dot), pairKey(src, remote.Addr), remote.Error)
+					failed = true
+				}
+			}
+		}
+		fmt.Println("Bottlenet results updated in", resp.File)
+		if failed {
+			return fmt.Errorf("some pairs failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	retestCmd.Flags().StringVar(&retestNode, "node", retestNode, "retest every pair this node was tested in")
+	retestCmd.Flags().StringArrayVar(&retestPairArgs, "pair", retestPairArgs, "retest the pair SRC,DST, may be repeated")
+	retestCmd.Flags().StringVar(&retestCoordinator, "coordinator", retestCoordinator, "address of the coordinator (default: this node)")
+	bottlenetCmd.AddCommand(retestCmd)
+}
@@ -0,0 +1,111 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sampleInterval is how often the aggregate throughput of a flood is
+// sampled
+const sampleInterval = 100 * time.Millisecond
+
+// throughputSampler periodically sums the byte counters of the streams
+// of a flood. Streams only ever add to their own counter, so sampling
+// needs no lock.
+type throughputSampler struct {
+	counters []int64
+	start    time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	// written by the sampling goroutine only, read after stopped
+	sampled sampledThroughput
+}
+
+// sampledThroughput is what a sampler measured over a flood
+type sampledThroughput struct {
+	// series holds one sample per full interval
+	series []float64
+	// samples is series plus the trailing partial interval
+	samples []float64
+	total   int64
+	start   time.Time
+	elapsed time.Duration
+}
+
+func newThroughputSampler(streams int) *throughputSampler {
+	s := &throughputSampler{
+		counters: make([]int64, streams),
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// counter returns the byte counter of stream i
+func (s *throughputSampler) counter(i int) *int64 {
+	return &s.counters[i]
+}
+
+func (s *throughputSampler) sum() int64 {
+	total := int64(0)
+	for i := range s.counters {
+		total += atomic.LoadInt64(&s.counters[i])
+	}
+	return total
+}
+
+func (s *throughputSampler) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	last := int64(0)
+	lastTime := s.start
+	for {
+		select {
+		case now := <-ticker.C:
+			total := s.sum()
+			s.sampled.series = append(s.sampled.series, float64(total-last)/now.Sub(lastTime).Seconds())
+			last, lastTime = total, now
+		case <-s.stop:
+			now := time.Now()
+			s.sampled.total = s.sum()
+			s.sampled.start = s.start
+			s.sampled.elapsed = now.Sub(s.start)
+			s.sampled.samples = append([]float64{}, s.sampled.series...)
+			// keep the partial interval unless it is all there is
+			if d := now.Sub(lastTime); d > 0 && (s.sampled.total > last || len(s.sampled.series) == 0) {
+				s.sampled.samples = append(s.sampled.samples, float64(s.sampled.total-last)/d.Seconds())
+			}
+			return
+		}
+	}
+}
+
+// finish stops sampling and returns what was measured
+func (s *throughputSampler) finish() sampledThroughput {
+	close(s.stop)
+	<-s.stopped
+	return s.sampled
+}
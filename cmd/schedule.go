@@ -0,0 +1,196 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pair is a single directional test, src floods dst
+type pair struct {
+	src *node
+	dst *node
+}
+
+// meshRounds splits every unordered pair of nodes into rounds of
+// disjoint pairs, so that no node takes part in two tests of the same
+// round. It uses the circle method of round-robin tournaments: N nodes
+// need N-1 rounds (N rounds if N is odd).
+//
+// Within a pair, the node that joined later sends to the one that
+// joined earlier.
+func meshRounds(nodes []*node) [][]pair {
+	index := map[*node]int{}
+	circle := []*node{}
+	for i, n := range nodes {
+		index[n] = i
+		circle = append(circle, n)
+	}
+	if len(circle)%2 == 1 {
+		// the node paired with the bye sits the round out
+		circle = append(circle, nil)
+	}
+
+	n := len(circle)
+	rounds := [][]pair{}
+	for r := 0; r < n-1; r++ {
+		round := []pair{}
+		for i := 0; i < n/2; i++ {
+			a, b := circle[i], circle[n-1-i]
+			if a == nil || b == nil {
+				continue
+			}
+			if index[a] < index[b] {
+				a, b = b, a
+			}
+			round = append(round, pair{src: a, dst: b})
+		}
+		if len(round) > 0 {
+			rounds = append(rounds, round)
+		}
+		// keep the first node fixed and rotate the others
+		last := circle[n-1]
+		copy(circle[2:], circle[1:n-1])
+		circle[1] = last
+	}
+	return rounds
+}
+
+// bidirectionalRounds follows every round with the same pairs reversed,
+// so that both directions of every pair are measured
+func bidirectionalRounds(rounds [][]pair) [][]pair {
+	both := [][]pair{}
+	for _, round := range rounds {
+		reversed := []pair{}
+		for _, p := range round {
+			reversed = append(reversed, pair{src: p.dst, dst: p.src})
+		}
+		both = append(both, round, reversed)
+	}
+	return both
+}
+
+// serialRounds runs one pair per round, in the order of rounds
+func serialRounds(rounds [][]pair) [][]pair {
+	serial := [][]pair{}
+	for _, round := range rounds {
+		for _, p := range round {
+			serial = append(serial, []pair{p})
+		}
+	}
+	return serial
+}
+
+// runRounds dispatches the pairs of each round concurrently and waits
+// for the round to finish before starting the next one. The remotes
+// measured by each sender are returned keyed by sender address; pairs
+// that failed carry an Error and do not stop the run. An error is only
+// returned if ctx is cancelled, along with the pairs tested so far.
+func runRounds(ctx context.Context, rounds [][]pair) (map[string][]*node, error) {
+	results := map[string][]*node{}
+
+	view, stop := observeRounds(rounds)
+	defer stop()
+
+	for r, round := range rounds {
+		view.startRound(r+1, len(round))
+		for i, remote := range runRound(ctx, view, newTestOptions(), round) {
+			if remote != nil {
+				src := round[i].src.Addr
+				results[src] = append(results[src], remote)
+			}
+		}
+		view.endRound()
+
+		if ctx.Err() != nil {
+			sortResults(results)
+			return results, ctx.Err()
+		}
+	}
+
+	sortResults(results)
+	return results, nil
+}
+
+// observeRounds creates the observer of a run and ticks it until the
+// returned func is called
+func observeRounds(rounds [][]pair) (runObserver, func()) {
+	view := newRunObserver(rounds)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(progressInterval):
+				view.tick()
+			}
+		}
+	}()
+	return view, func() { close(done) }
+}
+
+// runRound dispatches the pairs of a round concurrently and returns the
+// remote measured for each pair, in the order of round. Pairs that failed
+// carry an Error, pairs cancelled along with ctx are nil.
+func runRound(ctx context.Context, view runObserver, opts testOptions, round []pair) []*node {
+	remotes := make([]*node, len(round))
+	wg := sync.WaitGroup{}
+	for i, p := range round {
+		wg.Add(1)
+		go func(i int, p pair) {
+			defer wg.Done()
+			remote := &node{
+				NodeType: p.dst.NodeType,
+				Addr:     p.dst.Addr,
+				AltAddr:  p.dst.AltAddr,
+			}
+			err := doDispatch(ctx, p.src.Addr, opts, []*node{remote}, func(pr progress) {
+				// senders report their own advertised address
+				pr.Src, pr.Dst = p.src.Addr, p.dst.Addr
+				view.update(pr)
+			})
+			if err == nil && remote.Error != "" {
+				err = errors.New(remote.Error)
+			}
+			view.pairDone(p.src.Addr, p.dst.Addr, remote, err)
+			if ctx.Err() != nil {
+				// cancelled pairs are left out of the report
+				return
+			}
+			if err != nil && remote.Error == "" {
+				remote.Error = pairError(err)
+			}
+			remotes[i] = remote
+		}(i, p)
+	}
+	wg.Wait()
+	return remotes
+}
+
+func sortResults(results map[string][]*node) {
+	for _, remotes := range results {
+		sort.Slice(remotes, func(i, j int) bool {
+			return remotes[i].Addr < remotes[j].Addr
+		})
+	}
+}
@@ -26,26 +26,28 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg/payload"
 	"github.com/minio/bottlenet/pkg/perf"
 )
 
+// serverReady is closed once the bottlenet server accepts connections
+var serverReady = make(chan struct{})
+
 func newClient() *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 10 * time.Second,
-				DualStack: true,
-			}).DialContext,
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialContext,
 			MaxIdleConnsPerHost:   1024,
 			IdleConnTimeout:       90 * time.Second,
 			TLSHandshakeTimeout:   10 * time.Second,
@@ -54,6 +56,14 @@ func newClient() *http.Client {
 	}
 }
 
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 10 * time.Second,
+		DualStack: true,
+	}
+}
+
 func serveBottlenet(ctx context.Context, mux *http.ServeMux) error {
 	defaultMux := mux
 	if mux == nil {
@@ -61,19 +71,27 @@ func serveBottlenet(ctx context.Context, mux *http.ServeMux) error {
 	}
 	defaultMux.HandleFunc("/perf", listenPerf)
 	defaultMux.HandleFunc("/dispatch", listenDispatch)
+	defaultMux.HandleFunc("/info", listenInfo)
+	defaultMux.HandleFunc("/cancel", listenCancel)
 
 	server := http.Server{
-		Addr:    address,
+		Addr:    listenAddr(),
 		Handler: defaultMux,
 		BaseContext: func(net.Listener) context.Context {
 			return ctx
 		},
 	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	close(serverReady)
+
 	done := make(chan error, 1)
 	go func() {
 		errChan := make(chan error, 1)
 		go func() {
-			errChan <- server.ListenAndServe()
+			errChan <- server.Serve(ln)
 		}()
 		for {
 			select {
@@ -87,7 +105,7 @@ func serveBottlenet(ctx context.Context, mux *http.ServeMux) error {
 			}
 		}
 	}()
-	err := <-done
+	err = <-done
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			fmt.Println(err.Error())
@@ -96,16 +114,70 @@ func serveBottlenet(ctx context.Context, mux *http.ServeMux) error {
 	return err
 }
 
-func doDispatch(ctx context.Context, addr string, remotes []*node) error {
+// dispatchMessage is one line of the /dispatch response stream. The
+// sender streams progress while the tests run and ends the stream with
+// either the measured remotes or an error.
+type dispatchMessage struct {
+	Progress *progress       `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+	Remotes  json.RawMessage `json:",omitempty"`
+}
+
+// testOptions are set on the coordinator and sent along with every
+// dispatch, so that all senders test the same way
+type testOptions struct {
+	// Percentiles are reported in addition to the fixed ones
+	Percentiles []float64 `json:",omitempty"`
+	// Concurrent floods all remotes at the same time instead of one
+	// after the other
+	Concurrent bool `json:",omitempty"`
+	// Size and Streams fix the payload of each request and the number of
+	// parallel requests of a flood, instead of stepping down from the
+	// defaults until the link is no longer overloaded
+	Size    int64 `json:",omitempty"`
+	Streams int   `json:",omitempty"`
+	// Duration floods for this long instead of a fixed number of
+	// requests, without stepping down either
+	Duration time.Duration `json:",omitempty"`
+	// Payload selects the data sent
+	Payload payload.Options
+	// Verify has the receivers check every block of the data
+	Verify bool `json:",omitempty"`
+}
+
+// fixed tells whether the size, streams or duration of the floods are
+// set, in which case floods do not step down
+func (o testOptions) fixed() bool {
+	return o.Size > 0 || o.Streams > 0 || o.Duration > 0
+}
+
+func newTestOptions() testOptions {
+	return testOptions{
+		Percentiles: percentiles,
+		Payload:     payloadOptions,
+		Verify:      verifyData,
+	}
+}
+
+// dispatchRequest asks a sender to test the remotes
+type dispatchRequest struct {
+	Options testOptions
+	Remotes []*node
+}
+
+func doDispatch(ctx context.Context, addr string, opts testOptions, remotes []*node, onProgress func(progress)) error {
 	client := newClient()
 
-	jsonData, err := json.Marshal(remotes)
+	jsonData, err := json.Marshal(dispatchRequest{
+		Options: opts,
+		Remotes: remotes,
+	})
 	if err != nil {
 		return err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("http://%s/%s", addr, "dispatch"),
+		bottlenetURL(addr, "dispatch"),
 		bytes.NewReader(jsonData),
 	)
 	if err != nil {
@@ -117,31 +189,98 @@ func doDispatch(ctx context.Context, addr string, remotes []*node) error {
 	}
 	defer resp.Body.Close()
 
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf(string(respBody))
 	}
 
-	return json.Unmarshal(respBody, &remotes)
+	dec := json.NewDecoder(resp.Body)
+	for {
+		msg := dispatchMessage{}
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch {
+		case msg.Progress != nil:
+			if onProgress != nil {
+				onProgress(*msg.Progress)
+			}
+		case msg.Error != "":
+			return errors.New(msg.Error)
+		default:
+			return json.Unmarshal(msg.Remotes, &remotes)
+		}
+	}
 }
 
+// progressInterval is how often senders stream progress to the coordinator
+const progressInterval = 500 * time.Millisecond
+
 func listenDispatch(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	// the tests stop when the coordinator hangs up, or through /cancel
+	// while it waits for them
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer trackDispatch(cancel)()
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	p := &[]*node{}
-	if err := json.Unmarshal(body, p); err != nil {
+	dr := dispatchRequest{}
+	if err := json.Unmarshal(body, &dr); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	encLock := sync.Mutex{}
+	send := func(msg dispatchMessage) {
+		encLock.Lock()
+		defer encLock.Unlock()
+		enc.Encode(msg)
+		w.(http.Flusher).Flush()
+	}
+
+	// trackers holds the []*progressTracker of the running tests
+	var trackers atomic.Value
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(progressInterval):
+				ts, _ := trackers.Load().([]*progressTracker)
+				for _, t := range ts {
+					pr := t.snapshot()
+					send(dispatchMessage{Progress: &pr})
+				}
+			}
+		}
+	}()
+	finish := func(msg dispatchMessage) {
+		close(done)
+		<-stopped
+		send(msg)
+	}
+
 	resp := []*node{}
 	if !serverMode {
-		for _, px := range *p {
+		for _, px := range dr.Remotes {
 			if clientMode {
 				if px.NodeType != nodeTypeServer {
 					continue
@@ -150,177 +289,452 @@ func listenDispatch(w http.ResponseWriter, r *http.Request) {
 					continue
 				}
 			}
-			if err := doPerf(ctx, px); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
 			resp = append(resp, px)
 		}
 	}
+
+	ts := make([]*progressTracker, len(resp))
+	for i, px := range resp {
+		ts[i] = newProgressTracker(getLocalIPs()[0], px.Addr)
+	}
+	perfRemote := func(i int) {
+		// a failure is reported and the other remotes go on
+		if err := doPerf(ctx, resp[i], dr.Options, ts[i]); err != nil && ctx.Err() == nil {
+			resp[i].Error = pairError(err)
+		}
+	}
+	if dr.Options.Concurrent {
+		trackers.Store(ts)
+		wg := sync.WaitGroup{}
+		for i := range resp {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				perfRemote(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range resp {
+			trackers.Store(ts[i : i+1])
+			if perfRemote(i); ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		finish(dispatchMessage{Error: fmt.Sprintf("tests cancelled on %s: %v", getLocalIPs()[0], ctx.Err())})
+		return
+	}
+
 	respBody, err := json.Marshal(resp)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		finish(dispatchMessage{Error: err.Error()})
 		return
 	}
-	w.Write(respBody)
+	finish(dispatchMessage{Remotes: respBody})
 }
 
-func doPerf(ctx context.Context, p *node) error {
-	info, err := flood(ctx, p.Addr)
-	if err != nil {
-		return err
+func doPerf(ctx context.Context, p *node, opts testOptions, tracker *progressTracker) error {
+	addrs := []string{p.Addr}
+	if dualStack && p.AltAddr != "" {
+		addrs = append(addrs, p.AltAddr)
+	}
+	// a failing family does not keep the other one from being tested
+	errs := []string{}
+	for _, addr := range addrs {
+		info, err := flood(ctx, addr, opts, tracker)
+		if err != nil {
+			if ctx.Err() != nil || len(addrs) == 1 {
+				return err
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+			continue
+		}
+		if p.Perf == nil {
+			p.Perf = map[string]perf.Perf{}
+		}
+		p.Perf[addr] = info
 	}
-	if p.Perf == nil {
-		p.Perf = map[string]perf.Perf{}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
-	p.Perf[p.Addr] = info
 	return nil
 }
 
+// verifyHeader asks the receiver of /perf to verify the blocks of the
+// body
+const verifyHeader = "Bottlenet-Verify"
+
+// Trailers of /perf, sent once the body is read. FinalStatus is
+// "Success" unless the receiver failed to read the body.
+const (
+	finalStatusTrailer   = "FinalStatus"
+	receiverStatsTrailer = "Receiver-Stats"
+	finalStatusSuccess   = "Success"
+)
+
+// receiverStats is what the receiver of /perf measured, sent back as
+// JSON in the receiverStatsTrailer
+type receiverStats struct {
+	Bytes     int64
+	FirstByte time.Time
+	LastByte  time.Time
+	// Blocks and Corrupted are counted if the body was verified
+	Blocks    int64 `json:",omitempty"`
+	Corrupted int64 `json:",omitempty"`
+}
+
 func listenPerf(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// Use this trailer to send additional headers after sending body
-	w.Header().Set("Trailer", "FinalStatus")
+	w.Header().Set("Trailer", finalStatusTrailer)
+	w.Header().Add("Trailer", receiverStatsTrailer)
 
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.WriteHeader(http.StatusOK)
 
-	n, err := io.Copy(ioutil.Discard, newContextReader(ctx, r.Body))
-	if err == io.ErrUnexpectedEOF {
-		w.Header().Set("FinalStatus", err.Error())
-		return
+	body := &receiveReader{r: newContextReader(ctx, r.Body)}
+	stats := receiverStats{}
+	var err error
+	if r.Header.Get(verifyHeader) != "" {
+		var v payload.Verification
+		v, err = payload.Verify(body, r.ContentLength)
+		stats.Blocks, stats.Corrupted = v.Blocks, v.Corrupted
+	} else {
+		_, err = io.Copy(ioutil.Discard, body)
 	}
+	stats.Bytes, stats.FirstByte, stats.LastByte = body.n, body.first, body.last
+
+	status := finalStatusSuccess
 	if err != nil && err != io.EOF {
-		w.Header().Set("FinalStatus", err.Error())
-		return
+		status = err.Error()
+	} else if body.n != r.ContentLength {
+		status = fmt.Sprintf("bottlenet: short read: expected %d found %d", r.ContentLength, body.n)
 	}
-	if n != r.ContentLength {
-		err := fmt.Errorf("bottlenet: short read: expected %d found %d", r.ContentLength, n)
-		w.Header().Set("FinalStatus", err.Error())
-		return
+	if statsJSON, err := json.Marshal(stats); err == nil {
+		w.Header().Set(receiverStatsTrailer, string(statsJSON))
+	}
+	w.Header().Set(finalStatusTrailer, status)
+	if status == finalStatusSuccess {
+		w.(http.Flusher).Flush()
 	}
-	w.Header().Set("FinalStatus", "Success")
-	w.(http.Flusher).Flush()
 }
 
-func doFlood(ctx context.Context, remote string, dataSize int64, threadCount uint) (info perf.Perf, err error) {
-	latencies := []float64{}
-	throughputs := []float64{}
+// parseReceiverStats reads the trailers of a /perf response, failing if
+// the receiver did not read the whole body
+func parseReceiverStats(trailer http.Header) (receiverStats, error) {
+	stats := receiverStats{}
+	status := trailer.Get(finalStatusTrailer)
+	if status == "" {
+		return stats, errors.New("no status from the receiver")
+	}
+	if status != finalStatusSuccess {
+		return stats, errors.New(status)
+	}
+	if err := json.Unmarshal([]byte(trailer.Get(receiverStatsTrailer)), &stats); err != nil {
+		return stats, fmt.Errorf("invalid receiver stats: %v", err)
+	}
+	return stats, nil
+}
 
-	buf := make([]byte, dataSize)
+// floodSample is the latency and size of a single request of a flood
+type floodSample struct {
+	latency float64
+	bytes   int64
+}
 
-	buflimiter := make(chan struct{}, threadCount)
-	errChan := make(chan error, threadCount)
+// maxFloodSamples bounds the samples kept of a flood, the requests past
+// it are only added up
+const maxFloodSamples = 100000
+
+// floodStream collects the requests of one of the parallel streams of a
+// flood. Only the request holding the stream writes to it, so streams
+// are collected without a lock.
+type floodStream struct {
+	samples   []floodSample
+	receiver  perf.Receiver
+	integrity perf.Integrity
+	firstByte time.Time
+	lastByte  time.Time
+}
 
-	totalTransferred := int64(0)
-	transferChan := make(chan int64, threadCount)
+// add records a request the receiver accepted
+func (s *floodStream) add(sample floodSample, received receiverStats, keep bool) {
+	if keep {
+		s.samples = append(s.samples, sample)
+	}
+	s.receiver.Bytes += received.Bytes
+	s.integrity.Blocks += received.Blocks
+	s.integrity.Corrupted += received.Corrupted
+	if received.Corrupted > 0 {
+		s.integrity.CorruptedRequests++
+	}
+	if s.firstByte.IsZero() || received.FirstByte.Before(s.firstByte) {
+		s.firstByte = received.FirstByte
+	}
+	if received.LastByte.After(s.lastByte) {
+		s.lastByte = received.LastByte
+	}
+}
 
-	client := newClient()
+func doFlood(ctx context.Context, remote string, dataSize int64, threadCount uint, opts testOptions, tracker *progressTracker) (info perf.Perf, err error) {
+	// every request sends different data, generated as it is sent
+	seed := rand.Uint64()
 
-	go func() {
-		for v := range transferChan {
-			atomic.AddInt64(&totalTransferred, v)
+	// requests take a free stream and give it back once done
+	buflimiter := make(chan int, threadCount)
+	streams := make([]floodStream, threadCount)
+	for i := range streams {
+		buflimiter <- i
+	}
+	errChan := make(chan error, 1)
+	fail := func(err error) {
+		// keep the first error only
+		select {
+		case errChan <- err:
+		default:
 		}
-	}()
+	}
+
+	client := newClient()
 
 	// ensure enough samples to obtain normal distribution
 	maxSamples := int(10 * threadCount)
+	var deadline time.Time
+	if opts.Duration > 0 {
+		deadline = time.Now().Add(opts.Duration)
+	}
+	kept := int64(0)
+	sampler := newThroughputSampler(int(threadCount))
 
 	innerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	timeout := floodTimeout(dataSize, threadCount, opts.Duration)
 	slowSamples := int32(0)
 	maxSlowSamples := int32(maxSamples / 20)
 	slowSample := func() {
-		if slowSamples > maxSlowSamples { // 5% of total
+		if opts.fixed() {
+			// there is no smaller step to fall back to
+			return
+		}
+		if atomic.LoadInt32(&slowSamples) > maxSlowSamples { // 5% of total
 			return
 		}
 		if atomic.AddInt32(&slowSamples, 1) >= maxSlowSamples {
-			errChan <- networkOverloaded
+			fail(networkOverloaded)
 			cancel()
 		}
 	}
 
 	wg := sync.WaitGroup{}
-	finish := func() {
-		<-buflimiter
+	finish := func(stream int) {
+		buflimiter <- stream
 		wg.Done()
 	}
 
 loop:
-	for i := 0; i < maxSamples; i++ {
+	// a flood of a given duration sends requests until the deadline
+	for i := 0; !deadline.IsZero() || i < maxSamples; i++ {
 		select {
 		case <-ctx.Done():
-			return info, ctx.Err()
+			break loop
 		case err = <-errChan:
 			break loop
-		case buflimiter <- struct{}{}:
+		case stream := <-buflimiter:
 			wg.Add(1)
 
 			if innerCtx.Err() != nil {
-				finish()
-				continue
+				finish(stream)
+				break loop
+			}
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				finish(stream)
+				break loop
 			}
 
-			go func(i int) {
-				bufReader := bytes.NewReader(buf)
+			go func(i, stream int) {
+				counter := sampler.counter(stream)
+				data, err := payload.NewReader(opts.Payload, dataSize, seed+uint64(i))
+				if err != nil {
+					finish(stream)
+					fail(err)
+					return
+				}
+				var body io.Reader = data
+				if opts.Verify {
+					body = payload.NewVerifiedReader(data, dataSize)
+				}
 				bufReadCloser := ioutil.NopCloser(&progressReader{
-					r:            bufReader,
-					progressChan: transferChan,
+					r:       body,
+					n:       counter,
+					tracker: tracker,
 				})
+				before := atomic.LoadInt64(counter)
 				start := time.Now()
-				before := atomic.LoadInt64(&totalTransferred)
 
-				ctx, cancel := context.WithTimeout(innerCtx, 10*time.Second)
+				ctx, cancel := context.WithTimeout(innerCtx, timeout)
 				defer cancel()
 
 				req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-					fmt.Sprintf("http://%s/%s", remote, "perf"), bufReadCloser)
+					bottlenetURL(remote, "perf"), bufReadCloser)
 				if err != nil {
-					errChan <- err
-					finish()
+					finish(stream)
+					fail(err)
 					return
 				}
 				req.ContentLength = dataSize
+				if opts.Verify {
+					req.Header.Set(verifyHeader, "true")
+				}
 				resp, err := client.Do(req)
 				if err != nil {
-					if errors.Is(err, context.DeadlineExceeded) {
+					if errors.Is(err, context.DeadlineExceeded) && innerCtx.Err() == nil {
+						s := &streams[stream]
+						s.receiver.TimedOut++
+						s.receiver.LastError = fmt.Sprintf("request timed out after %s", timeout)
+						finish(stream)
 						slowSample()
-						finish()
 						return
 					}
-					finish()
-					errChan <- err
+					finish(stream)
+					fail(err)
 					return
 				}
 
 				defer resp.Body.Close()
 				io.Copy(ioutil.Discard, resp.Body)
 
-				after := atomic.LoadInt64(&totalTransferred)
-				finish()
-				end := time.Now()
-
-				latency := float64(end.Sub(start).Seconds())
+				latency := time.Since(start).Seconds()
+				sent := atomic.LoadInt64(counter) - before
+				// trailers are read once the body is consumed
+				received, err := parseReceiverStats(resp.Trailer)
+				if err == nil && received.Bytes != sent {
+					err = fmt.Errorf("receiver got %d of %d bytes", received.Bytes, sent)
+				}
+				s := &streams[stream]
+				if err != nil {
+					s.receiver.Rejected++
+					s.receiver.LastError = err.Error()
+					finish(stream)
+					return
+				}
+				keep := atomic.AddInt64(&kept, 1) <= maxFloodSamples
+				s.add(floodSample{latency: latency, bytes: sent}, received, keep)
+				finish(stream)
 
 				if latency > maxLatencyForSizeThreads(dataSize, threadCount) {
 					slowSample()
 				}
+			}(i, stream)
+		}
+	}
+	if err != nil || ctx.Err() != nil {
+		cancel()
+	}
+	wg.Wait()
+	sampled := sampler.finish()
 
-				/* Throughput = (total data transferred across all threads / time taken) */
-				throughput := float64(float64((after - before)) / latency)
+	if ctx.Err() != nil {
+		return info, ctx.Err()
+	}
+	if err == nil {
+		// errors of the last requests arrive after the loop is over
+		select {
+		case err = <-errChan:
+		default:
+		}
+	}
+	if err != nil {
+		return info, err
+	}
 
-				latencies = append(latencies, latency)
-				throughputs = append(throughputs, throughput)
-			}(i)
+	latencies := []float64{}
+	streamThroughputs := []float64{}
+	histograms := perf.Histograms{}
+	integrity := perf.Integrity{}
+	receiver := perf.Receiver{}
+	var firstByte, lastByte time.Time
+	for _, s := range streams {
+		receiver.Rejected += s.receiver.Rejected
+		receiver.TimedOut += s.receiver.TimedOut
+		if s.receiver.LastError != "" {
+			receiver.LastError = s.receiver.LastError
+		}
+		receiver.Bytes += s.receiver.Bytes
+		integrity.Blocks += s.integrity.Blocks
+		integrity.Corrupted += s.integrity.Corrupted
+		integrity.CorruptedRequests += s.integrity.CorruptedRequests
+		if !s.firstByte.IsZero() && (firstByte.IsZero() || s.firstByte.Before(firstByte)) {
+			firstByte = s.firstByte
+		}
+		if s.lastByte.After(lastByte) {
+			lastByte = s.lastByte
+		}
+		for _, sample := range s.samples {
+			latencies = append(latencies, sample.latency)
+			streamThroughputs = append(streamThroughputs, float64(sample.bytes)/sample.latency)
+			histograms.Latency.Record(sample.latency)
+			histograms.StreamThroughput.Record(float64(sample.bytes) / sample.latency)
 		}
 	}
-	wg.Wait()
+	for _, t := range sampled.samples {
+		histograms.Throughput.Record(t)
+	}
+	if len(latencies) == 0 {
+		return info, fmt.Errorf("no request completed, %d rejected and %d timed out: %s",
+			receiver.Rejected, receiver.TimedOut, receiver.LastError)
+	}
+	// the receiver's clock only ever measures its own span
+	receiver.FirstByte, receiver.LastByte = firstByte, lastByte
+	if lastByte.After(firstByte) {
+		receiver.Goodput = float64(receiver.Bytes) / lastByte.Sub(firstByte).Seconds()
+	}
 
+	if info, err = perf.ComputePerf(latencies, sampled.samples, opts.Percentiles...); err != nil {
+		return info, err
+	}
+	streamPerf, err := perf.ComputePerf(latencies, streamThroughputs, opts.Percentiles...)
 	if err != nil {
 		return info, err
 	}
+	info.StreamThroughput = streamPerf.Throughput
+	info.Streams = int(threadCount)
+	info.Series = perf.Series{
+		Interval: sampleInterval.Seconds(),
+		Samples:  sampled.series,
+	}
+	info.Histograms = histograms
+	info.Receiver = &receiver
+	info.Sent = &perf.Transfer{
+		Bytes: sampled.total,
+		Start: sampled.start,
+		End:   sampled.start.Add(sampled.elapsed),
+	}
+	if opts.Verify {
+		info.Integrity = &integrity
+	}
+	return info, nil
+}
 
-	return perf.ComputePerf(latencies, throughputs)
+// minFloodRate is the slowest link, in bytes per second, a request of a
+// flood is given the time to cross before it times out
+const minFloodRate = 0.125 * float64(humanize.GiByte)
+
+// floodTimeout bounds the requests of a flood. The streams share the
+// link, so a request may take as long as sending all of them at once:
+// twice that at minFloodRate, at least 10s, and for a timed flood at
+// least its duration, as a request started early may last all of it.
+func floodTimeout(dataSize int64, threadCount uint, duration time.Duration) time.Duration {
+	timeout := 10 * time.Second
+	if t := time.Duration(2 * float64(dataSize) * float64(threadCount) / minFloodRate * float64(time.Second)); t > timeout {
+		timeout = t
+	}
+	if duration > timeout {
+		timeout = duration
+	}
+	return timeout
 }
 
 func maxLatencyForSizeThreads(size int64, threadCount uint) float64 {
@@ -362,7 +776,14 @@ func maxLatencyForSizeThreads(size int64, threadCount uint) float64 {
 	return math.MaxFloat64
 }
 
-func flood(ctx context.Context, remote string) (info perf.Perf, err error) {
+// defaultFixedSize and defaultFixedStreams complete the options of a
+// fixed flood that leaves Size or Streams unset
+const (
+	defaultFixedSize    = 64 * humanize.MiByte
+	defaultFixedStreams = 8
+)
+
+func flood(ctx context.Context, remote string, opts testOptions, tracker *progressTracker) (info perf.Perf, err error) {
 
 	// 100 Gbit ->  256 MiB  *  50 threads
 	// 40 Gbit  ->  256 MiB  *  20 threads
@@ -397,11 +818,24 @@ func flood(ctx context.Context, remote string) (info perf.Perf, err error) {
 		},
 	}
 
+	if opts.fixed() {
+		size, threads := opts.Size, uint(opts.Streams)
+		if size == 0 {
+			size = defaultFixedSize
+		}
+		if threads == 0 {
+			threads = defaultFixedStreams
+		}
+		tracker.setStep(1, 1)
+		return doFlood(ctx, remote, size, threads, opts, tracker)
+	}
+
 	for i := range steps {
 		size := steps[i].size
 		threads := steps[i].threads
 
-		if info, err = doFlood(ctx, remote, size, threads); err != nil {
+		tracker.setStep(i+1, len(steps))
+		if info, err = doFlood(ctx, remote, size, threads, opts, tracker); err != nil {
 			if ctx.Err() != nil {
 				return info, err
 			}
@@ -0,0 +1,173 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg/payload"
+)
+
+// newPerfServer serves /perf over loopback
+func newPerfServer(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/perf", listenPerf)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+func TestDoFlood(t *testing.T) {
+	remote := newPerfServer(t)
+
+	testCases := []struct {
+		name string
+		opts testOptions
+		// requests is the number of requests expected, 0 if timed
+		requests int
+	}{
+		{
+			name:     "fixed",
+			opts:     testOptions{Size: humanize.MiByte, Streams: 4},
+			requests: 40,
+		},
+		{
+			name: "timed",
+			opts: testOptions{Size: 256 * humanize.KiByte, Streams: 4, Duration: 300 * time.Millisecond},
+		},
+		{
+			name: "verified",
+			opts: testOptions{
+				Size:     humanize.MiByte,
+				Streams:  2,
+				Duration: 200 * time.Millisecond,
+				Payload:  payload.Options{Pattern: payload.Random},
+				Verify:   true,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := newProgressTracker("src", remote)
+			start := time.Now()
+			info, err := flood(context.Background(), remote, tc.opts, tracker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.requests > 0 && info.Latency.Count != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, info.Latency.Count)
+			}
+			if elapsed := time.Since(start); elapsed < tc.opts.Duration {
+				t.Errorf("flood of %s ended after %s", tc.opts.Duration, elapsed)
+			}
+			if info.Streams != tc.opts.Streams {
+				t.Errorf("expected %d streams, got %d", tc.opts.Streams, info.Streams)
+			}
+			if info.Sent == nil || info.Receiver == nil {
+				t.Fatal("missing sender or receiver counts")
+			}
+			if info.Sent.Bytes != info.Receiver.Bytes {
+				t.Errorf("sent %d bytes, received %d", info.Sent.Bytes, info.Receiver.Bytes)
+			}
+			if info.Receiver.Rejected != 0 {
+				t.Errorf("receiver rejected %d requests: %s", info.Receiver.Rejected, info.Receiver.LastError)
+			}
+			if p := tracker.snapshot(); p.Bytes != info.Sent.Bytes {
+				t.Errorf("tracked %d bytes, sent %d", p.Bytes, info.Sent.Bytes)
+			}
+			if tc.opts.Verify {
+				if info.Integrity == nil || info.Integrity.Blocks == 0 {
+					t.Fatal("no verified blocks")
+				}
+				if info.Integrity.Corrupted != 0 {
+					t.Errorf("%d corrupted blocks over loopback", info.Integrity.Corrupted)
+				}
+			}
+		})
+	}
+}
+
+func TestDoFloodCancel(t *testing.T) {
+	remote := newPerfServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	opts := testOptions{Size: humanize.MiByte, Streams: 4, Duration: time.Minute}
+	start := time.Now()
+	if _, err := flood(ctx, remote, opts, nil); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancelled flood returned after %s", elapsed)
+	}
+}
+
+func TestThroughputSampler(t *testing.T) {
+	const streams = 8
+	sampler := newThroughputSampler(streams)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				atomic.AddInt64(sampler.counter(i), 10)
+			}
+		}(i)
+	}
+	time.Sleep(2 * sampleInterval)
+	wg.Wait()
+
+	sampled := sampler.finish()
+	if sampled.total != streams*1000*10 {
+		t.Errorf("expected %d bytes, got %d", streams*1000*10, sampled.total)
+	}
+	if len(sampled.series) == 0 {
+		t.Error("no sample taken")
+	}
+	if len(sampled.samples) < len(sampled.series) {
+		t.Errorf("%d samples for %d intervals", len(sampled.samples), len(sampled.series))
+	}
+}
+
+func TestFloodTimeout(t *testing.T) {
+	testCases := []struct {
+		size     int64
+		streams  uint
+		duration time.Duration
+		expected time.Duration
+	}{
+		{size: humanize.MiByte, streams: 8, expected: 10 * time.Second},
+		{size: 64 * humanize.MiByte, streams: 8, expected: 10 * time.Second},
+		{size: 64 * humanize.MiByte, streams: 16, expected: 16 * time.Second},
+		{size: humanize.MiByte, streams: 8, duration: time.Minute, expected: time.Minute},
+	}
+	for _, tc := range testCases {
+		if timeout := floodTimeout(tc.size, tc.streams, tc.duration); timeout != tc.expected {
+			t.Errorf("%s x %d for %s: expected %s, got %s", humanize.IBytes(uint64(tc.size)), tc.streams, tc.duration, tc.expected, timeout)
+		}
+	}
+}
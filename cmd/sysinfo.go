@@ -0,0 +1,125 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// hostInfo describes the machine a node runs on
+type hostInfo struct {
+	Hostname string
+	OS       string
+	Kernel   string
+	CPUs     int
+	NIC      nicInfo
+}
+
+// nicInfo describes the network interface a node advertises
+type nicInfo struct {
+	Name  string
+	Model string
+	// Speed is the link speed in Mbit/s, 0 if unknown
+	Speed int
+}
+
+func getHostInfo(addr string) *hostInfo {
+	hostname, _ := os.Hostname()
+	return &hostInfo{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Kernel:   readSysFile("/proc/sys/kernel/osrelease"),
+		CPUs:     runtime.NumCPU(),
+		NIC:      getNICInfo(addr),
+	}
+}
+
+// getNICInfo finds the interface that owns the host of addr and reads
+// its driver and link speed from sysfs where available
+func getNICInfo(addr string) nicInfo {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nicInfo{}
+	}
+	ip := net.ParseIP(strings.Split(host, "%")[0])
+	if ip == nil {
+		return nicInfo{}
+	}
+
+	inters, err := net.Interfaces()
+	if err != nil {
+		return nicInfo{}
+	}
+	for _, inter := range inters {
+		addrs, err := inter.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			x, _, err := net.ParseCIDR(a.String())
+			if err != nil || !x.Equal(ip) {
+				continue
+			}
+			nic := nicInfo{
+				Name: inter.Name,
+			}
+			sysPath := filepath.Join("/sys/class/net", inter.Name)
+			if driver, err := os.Readlink(filepath.Join(sysPath, "device", "driver")); err == nil {
+				nic.Model = filepath.Base(driver)
+			}
+			vendor := readSysFile(filepath.Join(sysPath, "device", "vendor"))
+			device := readSysFile(filepath.Join(sysPath, "device", "device"))
+			if vendor != "" && device != "" {
+				nic.Model = strings.TrimSpace(fmt.Sprintf("%s [%s:%s]", nic.Model, vendor, device))
+			}
+			if speed, err := strconv.Atoi(readSysFile(filepath.Join(sysPath, "speed"))); err == nil && speed > 0 {
+				nic.Speed = speed
+			}
+			return nic
+		}
+	}
+	return nicInfo{}
+}
+
+func readSysFile(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// parseLabels turns repeated --label key=value flags into a map
+func parseLabels(labels []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label '%s', expected key=value", l)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
@@ -0,0 +1,591 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/bottlenet/pkg"
+)
+
+const (
+	statusWaiting = "waiting for peers"
+	statusRunning = "running"
+	statusDone    = "done"
+	statusAborted = "aborted"
+)
+
+// dash is the full-screen dashboard of the coordinator, nil unless --tui
+var dash *dashboard
+
+// dashboard is a full-screen view of the coordinator showing the joined
+// peers, the throughput matrix as it fills up and the slowest and
+// fastest nodes. Commands are single keys read from stdin.
+type dashboard struct {
+	*progressView
+
+	mu      sync.Mutex
+	status  string
+	message string
+	// matrix holds the average throughput of each finished test,
+	// keyed by sender and then receiver
+	matrix map[string]map[string]float64
+	failed map[string]map[string]string
+	// busy is set while tests or a retest started from the dashboard run
+	busy int32
+	// cancel stops the tests or retest started from the dashboard,
+	// nil if none runs
+	cancel context.CancelFunc
+	// prompting is set while the pair to rerun is typed into input
+	prompting bool
+	input     string
+	// lines is the screen written by the last draw
+	lines []string
+}
+
+var (
+	terminalLock sync.Mutex
+	// terminalRestore gives the terminal back its mode from before the
+	// dashboard, nil unless the dashboard changed it
+	terminalRestore func()
+)
+
+// restoreTerminal undoes the raw mode of the dashboard, if any. Every
+// way out of bottlenet goes through it.
+func restoreTerminal() {
+	terminalLock.Lock()
+	defer terminalLock.Unlock()
+	if terminalRestore != nil {
+		terminalRestore()
+		terminalRestore = nil
+	}
+}
+
+// exitProcess restores the terminal and exits, as deferred calls do not
+// run on os.Exit
+func exitProcess(code int) {
+	restoreTerminal()
+	os.Exit(code)
+}
+
+func newDashboard() *dashboard {
+	return &dashboard{
+		progressView: &progressView{silent: true, active: map[string]progress{}},
+		status:       statusWaiting,
+		matrix:       map[string]map[string]float64{},
+		failed:       map[string]map[string]string{},
+	}
+}
+
+// reset prepares the dashboard for a new run, keeping the matrix of the
+// previous one until the new results come in
+func (d *dashboard) reset(rounds [][]pair) {
+	v := newProgressView(rounds)
+	v.silent = true
+
+	d.mu.Lock()
+	d.progressView = v
+	d.status = statusRunning
+	d.mu.Unlock()
+}
+
+func (d *dashboard) pairDone(src, dst string, remote *node, err error) {
+	d.view().pairDone(src, dst, remote, err)
+	d.record(src, dst, remote, err)
+}
+
+func (d *dashboard) update(p progress) {
+	d.view().update(p)
+}
+
+func (d *dashboard) startRound(round, pairs int) {
+	d.view().startRound(round, pairs)
+}
+
+func (d *dashboard) endRound() {
+	d.view().endRound()
+}
+
+func (d *dashboard) tick() {
+	d.draw()
+}
+
+func (d *dashboard) view() *progressView {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.progressView
+}
+
+// record stores the outcome of a test in the matrix
+func (d *dashboard) record(src, dst string, remote *node, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.matrix[src] == nil {
+		d.matrix[src] = map[string]float64{}
+	}
+	if d.failed[src] == nil {
+		d.failed[src] = map[string]string{}
+	}
+	delete(d.matrix[src], dst)
+	delete(d.failed[src], dst)
+	if err != nil {
+		d.failed[src][dst] = err.Error()
+		return
+	}
+	if remote == nil {
+		return
+	}
+	if p, ok := remote.Perf[dst]; ok {
+		d.matrix[src][dst] = p.Throughput.Avg
+	}
+}
+
+// newRun returns the context of a run started from the dashboard,
+// cancelling the previous one
+func (d *dashboard) newRun() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.cancel = cancel
+	return ctx
+}
+
+// stopRun cancels the run started from the dashboard, if any
+func (d *dashboard) stopRun() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+}
+
+func (d *dashboard) setStatus(status, message string) {
+	d.mu.Lock()
+	d.status = status
+	d.message = message
+	d.mu.Unlock()
+	d.draw()
+}
+
+func (d *dashboard) setMessage(message string) {
+	d.mu.Lock()
+	d.message = message
+	d.mu.Unlock()
+	d.draw()
+}
+
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// repaintTicks is the number of draws between two full repaints
+const repaintTicks = 10
+
+// runDashboard redraws the dashboard and executes the keys pressed on
+// stdin until 'q' is pressed
+func runDashboard() {
+	// if stdin is not a terminal, keys are read once enter is pressed
+	if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+		terminalLock.Lock()
+		terminalRestore = restore
+		terminalLock.Unlock()
+	}
+	fmt.Print("\033[2J")
+
+	go func() {
+		for i := 0; ; i++ {
+			if i%repaintTicks == 0 {
+				// paint over whatever else was printed meanwhile
+				dash.mu.Lock()
+				dash.lines = nil
+				dash.mu.Unlock()
+			}
+			dash.draw()
+			<-time.After(progressInterval)
+		}
+	}()
+	go func() {
+		for range testChan {
+			dash.draw()
+		}
+	}()
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		key, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		dash.key(key)
+	}
+}
+
+func (d *dashboard) key(key byte) {
+	d.mu.Lock()
+	prompting := d.prompting
+	d.mu.Unlock()
+	if prompting {
+		d.promptKey(key)
+		return
+	}
+
+	switch key {
+	case 's':
+		if !d.start() {
+			d.setMessage("tests are already running")
+		}
+	case 'a':
+		d.abort()
+	case 'r':
+		if d.running() {
+			d.setMessage("wait for the tests to finish before rerunning a pair")
+			return
+		}
+		d.mu.Lock()
+		d.prompting = true
+		d.input = ""
+		d.message = ""
+		d.mu.Unlock()
+		d.draw()
+	case 'q', keyCtrlD:
+		d.quit()
+	case keyCtrlC:
+		// like the first signal, a running test is aborted first
+		if !d.abort() {
+			d.quit()
+		}
+	case '\r', '\n', ' ':
+	default:
+		d.setMessage(fmt.Sprintf("unknown key '%c'", key))
+	}
+}
+
+// promptKey edits the pair to rerun, which is run on enter
+func (d *dashboard) promptKey(key byte) {
+	d.mu.Lock()
+	switch key {
+	case '\r', '\n':
+		d.prompting = false
+		fields := strings.Fields(d.input)
+		if len(fields) != 2 {
+			d.message = "usage: SRC DST"
+			break
+		}
+		if !d.rerun(fields[0], fields[1]) {
+			d.message = "wait for the tests to finish before rerunning a pair"
+		}
+	case keyEscape, keyCtrlC:
+		d.prompting = false
+	case keyBackspace, keyDelete:
+		if len(d.input) > 0 {
+			d.input = d.input[:len(d.input)-1]
+		}
+	default:
+		if key >= ' ' && key < keyDelete {
+			d.input += string(key)
+		}
+	}
+	d.mu.Unlock()
+	d.draw()
+}
+
+// abort cancels the running tests, returns false if none run
+func (d *dashboard) abort() bool {
+	if !d.running() {
+		d.setMessage("no tests are running")
+		return false
+	}
+	if !cancelRun() {
+		d.stopRun()
+	}
+	d.setStatus(statusAborted, "tests aborted")
+	return true
+}
+
+func (d *dashboard) quit() {
+	if !cancelRun() {
+		d.stopRun()
+	}
+	fmt.Print("\033[2J\033[H")
+	exitProcess(0)
+}
+
+func (d *dashboard) running() bool {
+	return atomic.LoadInt32(&d.busy) == 1
+}
+
+// start runs the tests in the background, unless tests or a retest
+// are already running
+func (d *dashboard) start() bool {
+	if !atomic.CompareAndSwapInt32(&d.busy, 0, 1) {
+		return false
+	}
+	// a /retest may be running without the dashboard
+	if !atomic.CompareAndSwapInt32(&testRunning, 0, 1) {
+		atomic.StoreInt32(&d.busy, 0)
+		return false
+	}
+	go func() {
+		defer atomic.StoreInt32(&d.busy, 0)
+		defer atomic.StoreInt32(&testRunning, 0)
+
+		ctx := d.newRun()
+		defer d.stopRun()
+		runDashboardTest(ctx)
+	}()
+	return true
+}
+
+// rerun retests a pair in the background, unless tests or a retest
+// are already running
+func (d *dashboard) rerun(src, dst string) bool {
+	if !atomic.CompareAndSwapInt32(&d.busy, 0, 1) {
+		return false
+	}
+	go func() {
+		defer atomic.StoreInt32(&d.busy, 0)
+		d.rerunPair(src, dst)
+	}()
+	return true
+}
+
+// rerunPair tests a single pair again and merges it into the last
+// report. SRC and DST are either addresses or the indices shown on the
+// dashboard.
+func (d *dashboard) rerunPair(srcArg, dstArg string) {
+	nodes := dashboardNodes()
+	find := func(arg string) string {
+		for i, n := range nodes {
+			if n.Addr == arg || fmt.Sprint(i+1) == arg {
+				return n.Addr
+			}
+		}
+		return arg
+	}
+	src, dst := find(srcArg), find(dstArg)
+
+	d.setMessage(fmt.Sprintf("retesting %s", pairKey(src, dst)))
+	ctx := d.newRun()
+	defer d.stopRun()
+	resp, err := retest(ctx, retestRequest{
+		Pairs: [][]string{{src, dst}},
+	})
+	if err != nil {
+		d.setStatus(statusDone, fmt.Sprintf("retest of %s failed: %v", pairKey(src, dst), err))
+		return
+	}
+	d.setStatus(statusDone, fmt.Sprintf("retested %s, results updated in %s", pairKey(src, dst), resp.File))
+}
+
+func dashboardNodes() []*node {
+	nodeLock.Lock()
+	defer nodeLock.Unlock()
+	return append([]*node{}, peers...)
+}
+
+// nodeRanking averages the finished tests touching each node, slowest first
+func (d *dashboard) nodeRanking() []pairThroughput {
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for src, dsts := range d.matrix {
+		for dst, t := range dsts {
+			sums[src] += t
+			counts[src]++
+			sums[dst] += t
+			counts[dst]++
+		}
+	}
+	ranking := []pairThroughput{}
+	for addr, sum := range sums {
+		ranking = append(ranking, pairThroughput{
+			Src:        addr,
+			Throughput: sum / float64(counts[addr]),
+		})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Throughput == ranking[j].Throughput {
+			return ranking[i].Src < ranking[j].Src
+		}
+		return ranking[i].Throughput < ranking[j].Throughput
+	})
+	return ranking
+}
+
+func (d *dashboard) draw() {
+	nodes := dashboardNodes()
+	v := d.view()
+
+	v.mu.Lock()
+	header := fmt.Sprintf("round %d/%d  pairs %d/%d  ETA %s", v.round, v.rounds, v.pairsDone, v.pairs, v.eta())
+	active := v.sortedActive()
+	v.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s bottlenet %s  coordinator %s  %s\n", infoText(dot), pkg.Version, getLocalIPs()[0], greenText(d.status))
+	if d.status != statusWaiting {
+		fmt.Fprintf(b, "%s\n", header)
+	}
+
+	testing := map[string]string{}
+	sending := map[string]string{}
+	for _, p := range active {
+		addStatus := func(addr, status string) {
+			if s, ok := testing[addr]; ok {
+				status = s + "; " + status
+			}
+			testing[addr] = status
+		}
+		addStatus(p.Src, fmt.Sprintf("sending to %s, step %d/%d, %s", p.Dst, p.Step, p.Steps, humanize.IBytes(uint64(p.Bytes))))
+		addStatus(p.Dst, fmt.Sprintf("receiving from %s", p.Src))
+		sending[p.Src] = p.Dst
+	}
+
+	fmt.Fprintf(b, "\nPeers:\n")
+	for i, n := range nodes {
+		hostname := ""
+		if n.Host != nil {
+			hostname = n.Host.Hostname
+		}
+		status, ok := testing[n.Addr]
+		if !ok {
+			status = "idle"
+		}
+		fmt.Fprintf(b, "%3d. %-24s %-16s %s\n", i+1, n.Addr, hostname, status)
+	}
+
+	fmt.Fprintf(b, "\nThroughput (row sends to column):\n%6s", "")
+	for i := range nodes {
+		fmt.Fprintf(b, "%11d", i+1)
+	}
+	fmt.Fprintf(b, "\n")
+	for i, src := range nodes {
+		fmt.Fprintf(b, "%6d", i+1)
+		for _, dst := range nodes {
+			cell := ""
+			if t, ok := d.matrix[src.Addr][dst.Addr]; ok {
+				cell = humanize.IBytes(uint64(t))
+			} else if _, ok := d.failed[src.Addr][dst.Addr]; ok {
+				cell = "failed"
+			} else if src == dst {
+				cell = "-"
+			} else if sending[src.Addr] == dst.Addr {
+				cell = "..."
+			}
+			fmt.Fprintf(b, "%11s", cell)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+
+	ranking := d.nodeRanking()
+	if len(ranking) > 0 {
+		top := 3
+		if top > len(ranking) {
+			top = len(ranking)
+		}
+		fmt.Fprintf(b, "\nSlowest nodes:\n")
+		for _, r := range ranking[:top] {
+			fmt.Fprintf(b, "  %-24s %s/s\n", r.Src, humanize.IBytes(uint64(r.Throughput)))
+		}
+		fmt.Fprintf(b, "Fastest nodes:\n")
+		for i := len(ranking) - 1; i >= len(ranking)-top; i-- {
+			fmt.Fprintf(b, "  %-24s %s/s\n", ranking[i].Src, humanize.IBytes(uint64(ranking[i].Throughput)))
+		}
+	}
+
+	if d.message != "" {
+		fmt.Fprintf(b, "\n%s\n", d.message)
+	}
+	fmt.Fprintf(b, "\n[s] start  [a] abort  [r] rerun pair  [q] quit\n")
+	if d.prompting {
+		fmt.Fprintf(b, "rerun SRC DST: %s", d.input)
+	}
+
+	// rewrite only the lines that changed since the last draw
+	lines := strings.Split(b.String(), "\n")
+	out := &strings.Builder{}
+	for i, line := range lines {
+		if i < len(d.lines) && d.lines[i] == line {
+			continue
+		}
+		fmt.Fprintf(out, "\033[%d;1H%s\033[K", i+1, line)
+	}
+	if len(lines) < len(d.lines) {
+		fmt.Fprintf(out, "\033[%d;1H\033[J", len(lines)+1)
+	}
+	if out.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\033[%d;%dH", len(lines), len(lines[len(lines)-1])+1)
+	d.lines = lines
+	fmt.Print(out.String())
+}
+
+// runDashboardTest runs the tests and saves the report without exiting,
+// so that pairs can be rerun from the dashboard afterwards
+func runDashboardTest(ctx context.Context) {
+	resp, err := doStart(ctx, getLocalIPs()[0])
+	if err != nil {
+		if ctx.Err() != nil {
+			dash.setStatus(statusAborted, "tests aborted")
+			return
+		}
+		dash.setStatus(statusDone, err.Error())
+		return
+	}
+	if err := summarizeReport(&resp); err != nil {
+		dash.setStatus(statusDone, err.Error())
+		return
+	}
+	filename, err := saveResults(resp)
+	if err != nil {
+		dash.setStatus(statusDone, err.Error())
+		return
+	}
+	storeReport(resp, filename)
+	if resp.Status == statusCancelled {
+		dash.setStatus(statusAborted, fmt.Sprintf("tests aborted, partial results saved to %s", filename))
+		return
+	}
+	if failures := reportFailures(resp); len(failures) > 0 {
+		dash.setStatus(statusDone, fmt.Sprintf("%d pair(s) failed, results saved to %s", len(failures), filename))
+		return
+	}
+	dash.setStatus(statusDone, fmt.Sprintf("Bottlenet results saved to %s", filename))
+}
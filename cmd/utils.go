@@ -20,9 +20,13 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
@@ -139,9 +143,27 @@ func (n networkOverloadedErr) Error() string {
 	return "network overloaded"
 }
 
+// pairError describes why a pair could not be tested, for the report
+func pairError(err error) string {
+	var netErr net.Error
+	switch {
+	case err == networkOverloaded:
+		return "network overloaded at all steps"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused: " + err.Error()
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout: " + err.Error()
+	}
+	return err.Error()
+}
+
+// progressReader counts the bytes read from r into the counter of its
+// stream and the progress of the test
 type progressReader struct {
-	r            io.Reader
-	progressChan chan int64
+	r       io.Reader
+	n       *int64
+	tracker *progressTracker
 }
 
 func (p *progressReader) Read(b []byte) (int, error) {
@@ -149,7 +171,30 @@ func (p *progressReader) Read(b []byte) (int, error) {
 	if err != nil && err != io.EOF {
 		return n, err
 	}
-	p.progressChan <- int64(n)
+	atomic.AddInt64(p.n, int64(n))
+	p.tracker.addBytes(int64(n))
+	return n, err
+}
+
+// receiveReader counts the bytes of a /perf body and when the first and
+// the last of them were read
+type receiveReader struct {
+	r     io.Reader
+	n     int64
+	first time.Time
+	last  time.Time
+}
+
+func (r *receiveReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		now := time.Now()
+		if r.first.IsZero() {
+			r.first = now
+		}
+		r.last = now
+		r.n += int64(n)
+	}
 	return n, err
 }
 
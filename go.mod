@@ -3,9 +3,11 @@ module github.com/minio/bottlenet
 require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/fatih/color v1.10.0
+	github.com/mattn/go-isatty v0.0.12
 	github.com/minio/minio v0.0.0-20201112225111-3595cb1267b3
 	github.com/montanaflynn/stats v0.6.3
 	github.com/spf13/cobra v1.1.1
+	golang.org/x/sys v0.0.0-20200915084602-288bc346aa39
 )
 
 go 1.13
@@ -0,0 +1,231 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// AsymmetryOptions tune when a pair or a node is reported as asymmetric
+type AsymmetryOptions struct {
+	// Threshold is the relative difference between the two directions
+	// beyond which they are reported, e.g. 0.2 for 20%
+	Threshold float64
+	// MinZScore is how many standard errors a node's transmit to
+	// receive ratio must lie from the typical node's
+	MinZScore float64
+}
+
+// DefaultAsymmetryOptions report directions that differ by more than 20%
+var DefaultAsymmetryOptions = AsymmetryOptions{
+	Threshold: 0.2,
+	MinZScore: 2,
+}
+
+// PairAsymmetry compares the two directions of a pair, A to B being
+// the forward one
+type PairAsymmetry struct {
+	A                 string
+	B                 string
+	ForwardThroughput float64
+	ReverseThroughput float64
+	// ThroughputRatio is the slower direction relative to the faster
+	ThroughputRatio float64
+	ForwardLatency  float64
+	ReverseLatency  float64
+	// LatencyRatio is the faster direction relative to the slower, 0 if
+	// the directions ran different numbers of streams
+	LatencyRatio float64
+	Asymmetric   bool
+}
+
+// NodeAsymmetry is the transmit capacity of a node relative to its
+// receive capacity, compared to the typical node
+type NodeAsymmetry struct {
+	Node string
+	// Ratio is above 1 if the node sends faster than it receives
+	Ratio      float64
+	ZScore     float64
+	Confidence float64
+	Asymmetric bool
+}
+
+// Asymmetry lists the pairs measured in both directions and the nodes
+// whose transmit and receive capacities differ
+type Asymmetry struct {
+	Pairs []PairAsymmetry
+	Nodes []NodeAsymmetry
+}
+
+// AsymmetricPairs returns the pairs flagged as asymmetric
+func (a *Asymmetry) AsymmetricPairs() []PairAsymmetry {
+	pairs := []PairAsymmetry{}
+	for _, p := range a.Pairs {
+		if p.Asymmetric {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// AsymmetricNodes returns the nodes flagged as asymmetric
+func (a *Asymmetry) AsymmetricNodes() []NodeAsymmetry {
+	nodes := []NodeAsymmetry{}
+	for _, n := range a.Nodes {
+		if n.Asymmetric {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// ratio is the smaller of a and b relative to the larger
+func ratio(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	return math.Min(a, b) / math.Max(a, b)
+}
+
+// DetectAsymmetry compares the directions of every pair measured both
+// ways. Each node is given a transmit to receive imbalance g, fitted by
+// least squares to the log ratio of the directions of its pairs,
+//
+//	log t(a, b) - log t(b, a) = g(a) - g(b) + r(a, b)
+//
+// A node whose g stands out is likely to have a duplex mismatch, a bad
+// bonding hash policy or per-direction QoS. Returns nil if no pair was
+// measured both ways.
+func DetectAsymmetry(ms []Measurement, opts AsymmetryOptions) *Asymmetry {
+	type key struct{ src, dst string }
+	measured := map[key]Measurement{}
+	for _, m := range ms {
+		measured[key{m.Src, m.Dst}] = m
+	}
+
+	asym := &Asymmetry{}
+	index := map[string]int{}
+	names := []string{}
+	type diff struct {
+		a, b int
+		d    float64
+	}
+	diffs := []diff{}
+	for k, fwd := range measured {
+		if k.src > k.dst {
+			continue
+		}
+		rev, ok := measured[key{k.dst, k.src}]
+		if !ok {
+			continue
+		}
+		p := PairAsymmetry{
+			A:                 k.src,
+			B:                 k.dst,
+			ForwardThroughput: fwd.Throughput,
+			ReverseThroughput: rev.Throughput,
+			ThroughputRatio:   ratio(fwd.Throughput, rev.Throughput),
+			ForwardLatency:    fwd.Latency,
+			ReverseLatency:    rev.Latency,
+		}
+		if fwd.Streams == rev.Streams {
+			p.LatencyRatio = ratio(fwd.Latency, rev.Latency)
+		}
+		p.Asymmetric = p.ThroughputRatio < 1-opts.Threshold ||
+			(p.LatencyRatio > 0 && p.LatencyRatio < 1-opts.Threshold)
+		asym.Pairs = append(asym.Pairs, p)
+
+		if fwd.Throughput <= 0 || rev.Throughput <= 0 {
+			continue
+		}
+		for _, n := range []string{k.src, k.dst} {
+			if _, ok := index[n]; !ok {
+				index[n] = len(names)
+				names = append(names, n)
+			}
+		}
+		diffs = append(diffs, diff{
+			a: index[k.src],
+			b: index[k.dst],
+			d: math.Log(fwd.Throughput) - math.Log(rev.Throughput),
+		})
+	}
+	if len(asym.Pairs) == 0 {
+		return nil
+	}
+	sort.Slice(asym.Pairs, func(i, j int) bool {
+		return asym.Pairs[i].ThroughputRatio < asym.Pairs[j].ThroughputRatio
+	})
+
+	// on a complete graph the least squares imbalance of a node is the
+	// mean of the log ratios of its pairs, iterate for the others
+	g := make([]float64, len(names))
+	degree := make([]int, len(names))
+	for _, d := range diffs {
+		degree[d.a]++
+		degree[d.b]++
+	}
+	for iter := 0; iter < fitIterations; iter++ {
+		change := 0.0
+		for k := range g {
+			sum := 0.0
+			for _, d := range diffs {
+				switch k {
+				case d.a:
+					sum += d.d + g[d.b]
+				case d.b:
+					sum += -d.d + g[d.a]
+				}
+			}
+			v := sum / float64(degree[k])
+			change = math.Max(change, math.Abs(v-g[k]))
+			g[k] = v
+		}
+		if change < 1e-9 {
+			break
+		}
+	}
+	med := median(g)
+	for k := range g {
+		g[k] -= med
+	}
+
+	residuals := []float64{}
+	for _, d := range diffs {
+		residuals = append(residuals, d.d-g[d.a]+g[d.b])
+	}
+	sigma := robustStdDev(residuals)
+
+	for k, name := range names {
+		n := NodeAsymmetry{
+			Node:  name,
+			Ratio: math.Exp(g[k]),
+		}
+		if sigma > 0 {
+			n.ZScore = g[k] / (sigma / math.Sqrt(float64(degree[k])))
+		}
+		n.Confidence = confidence(n.ZScore)
+		n.Asymmetric = ratio(n.Ratio, 1) < 1-opts.Threshold && math.Abs(n.ZScore) > opts.MinZScore
+		asym.Nodes = append(asym.Nodes, n)
+	}
+	sort.Slice(asym.Nodes, func(i, j int) bool {
+		return math.Abs(asym.Nodes[i].ZScore) > math.Abs(asym.Nodes[j].ZScore)
+	})
+	return asym
+}
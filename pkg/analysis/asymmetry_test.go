@@ -0,0 +1,121 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package analysis
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDetectAsymmetry(t *testing.T) {
+	testCases := []struct {
+		name  string
+		scale func(src, dst string) float64
+		pairs []string
+		nodes []string
+	}{
+		{
+			name:  "symmetric",
+			scale: uniform,
+		},
+		{
+			name: "asymmetric pair",
+			scale: func(src, dst string) float64 {
+				if src == "n6" && dst == "n7" {
+					return 0.6
+				}
+				return 1
+			},
+			pairs: []string{"n6 <-> n7"},
+		},
+		{
+			name: "slow link in both directions",
+			scale: func(src, dst string) float64 {
+				if (src == "n1" && dst == "n5") || (src == "n5" && dst == "n1") {
+					return 0.4
+				}
+				return 1
+			},
+		},
+		{
+			name: "node sending slower than it receives",
+			scale: func(src, dst string) float64 {
+				if src == "n2" {
+					return 0.5
+				}
+				return 1
+			},
+			pairs: []string{"n1 <-> n2", "n2 <-> n3", "n2 <-> n4", "n2 <-> n5", "n2 <-> n6", "n2 <-> n7", "n2 <-> n8"},
+			nodes: []string{"n2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			asym := DetectAsymmetry(mesh(8, tc.scale), DefaultAsymmetryOptions)
+			if asym == nil {
+				t.Fatal("expected the pairs measured both ways")
+			}
+			if len(asym.Pairs) != 8*7/2 {
+				t.Errorf("expected %d pairs, got %d", 8*7/2, len(asym.Pairs))
+			}
+			pairs := []string{}
+			for _, p := range asym.AsymmetricPairs() {
+				pairs = append(pairs, p.A+" <-> "+p.B)
+			}
+			sort.Strings(pairs)
+			nodes := []string{}
+			for _, n := range asym.AsymmetricNodes() {
+				nodes = append(nodes, n.Node)
+			}
+			if !reflect.DeepEqual(pairs, append([]string{}, tc.pairs...)) {
+				t.Errorf("expected asymmetric pairs %v, got %v", tc.pairs, pairs)
+			}
+			if !reflect.DeepEqual(nodes, append([]string{}, tc.nodes...)) {
+				t.Errorf("expected asymmetric nodes %v, got %v", tc.nodes, nodes)
+			}
+		})
+	}
+}
+
+func TestDetectAsymmetryRatios(t *testing.T) {
+	asym := DetectAsymmetry(mesh(8, func(src, dst string) float64 {
+		if src == "n2" {
+			return 0.5
+		}
+		return 1
+	}), DefaultAsymmetryOptions)
+	n := asym.Nodes[0]
+	if n.Node != "n2" || n.Ratio < 0.45 || n.Ratio > 0.55 {
+		t.Errorf("expected n2 sending at half its receive rate, got %s at %.2f", n.Node, n.Ratio)
+	}
+	if n.ZScore > -DefaultAsymmetryOptions.MinZScore {
+		t.Errorf("expected a negative z-score, got %.2f", n.ZScore)
+	}
+}
+
+func TestDetectAsymmetryOneWay(t *testing.T) {
+	ms := []Measurement{
+		{Src: "n1", Dst: "n2", Throughput: 1e9},
+		{Src: "n2", Dst: "n3", Throughput: 1e9},
+		{Src: "n3", Dst: "n1", Throughput: 1e9},
+	}
+	if asym := DetectAsymmetry(ms, DefaultAsymmetryOptions); asym != nil {
+		t.Errorf("expected nil without pairs measured both ways, got %+v", asym)
+	}
+}
@@ -0,0 +1,330 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package analysis attributes the throughput measured between pairs of
+// nodes to the nodes and links that limit it.
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Measurement is the throughput and latency measured from Src to Dst
+type Measurement struct {
+	Src        string
+	Dst        string
+	Throughput float64
+	// Latency is optional, 0 if unknown
+	Latency float64
+	// Streams is the number of concurrent streams of the measurement,
+	// latencies are only comparable between equal numbers of streams
+	Streams int
+}
+
+// Options tune when a node or a link is reported as anomalous
+type Options struct {
+	// MinZScore is how many standard errors below the fit an estimate
+	// must lie
+	MinZScore float64
+	// MaxRatio is the ratio to the expected throughput an estimate must
+	// fall under, so that insignificant slowdowns on a quiet network
+	// are not reported
+	MaxRatio float64
+}
+
+// DefaultOptions report estimates two standard errors and 10% below the fit
+var DefaultOptions = Options{
+	MinZScore: 2,
+	MaxRatio:  0.9,
+}
+
+// NodeEstimate is the capacity fitted for a node
+type NodeEstimate struct {
+	Node string
+	// Capacity is the throughput the node is expected to reach with a
+	// typical peer over a typical link
+	Capacity float64
+	// Ratio is Capacity relative to the typical node
+	Ratio      float64
+	ZScore     float64
+	Confidence float64
+	Anomalous  bool
+}
+
+// LinkEstimate compares the throughput of a pair to what the capacities
+// of its nodes predict
+type LinkEstimate struct {
+	Src        string
+	Dst        string
+	Measured   float64
+	Expected   float64
+	Ratio      float64
+	ZScore     float64
+	Confidence float64
+	Anomalous  bool
+}
+
+// Attribution tells slow nodes from slow links
+type Attribution struct {
+	Nodes []NodeEstimate
+	Links []LinkEstimate
+	// ResidualStdDev is the spread, in log space, of the links the node
+	// capacities explain
+	ResidualStdDev float64
+}
+
+// AnomalousNodes returns the nodes flagged as anomalous, slowest first
+func (a *Attribution) AnomalousNodes() []NodeEstimate {
+	nodes := []NodeEstimate{}
+	for _, n := range a.Nodes {
+		if n.Anomalous {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// AnomalousLinks returns the links flagged as anomalous, slowest first
+func (a *Attribution) AnomalousLinks() []LinkEstimate {
+	links := []LinkEstimate{}
+	for _, l := range a.Links {
+		if l.Anomalous {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// fitIterations bounds the backfitting of the node factors
+const fitIterations = 1000
+
+// outlierZScore is the residual beyond which a link is left out of the
+// fit of the node capacities, so that a single bad cable does not drag
+// down both of its nodes
+const outlierZScore = 3
+
+// Attribute fits the log throughput of every pair as the sum of a
+// factor of each of its nodes,
+//
+//	log t(a, b) = mu + f(a) + f(b) + r(a, b)
+//
+// by least squares, leaving out the links that the fit cannot explain.
+// A node is slow if its factor is significantly below the others, a link
+// is slow if its residual r is significantly below zero. This assumes
+// a node sends and receives at the same rate. At least three nodes are
+// needed, and four to tell a node from its links.
+func Attribute(ms []Measurement, opts Options) (*Attribution, error) {
+	index := map[string]int{}
+	names := []string{}
+	for _, m := range ms {
+		if m.Throughput <= 0 {
+			return nil, fmt.Errorf("throughput of %s -> %s must be positive", m.Src, m.Dst)
+		}
+		for _, n := range []string{m.Src, m.Dst} {
+			if _, ok := index[n]; !ok {
+				index[n] = len(names)
+				names = append(names, n)
+			}
+		}
+	}
+	if len(names) < 3 {
+		return nil, fmt.Errorf("at least 3 nodes are needed, found %d", len(names))
+	}
+
+	type obs struct {
+		a, b int
+		y    float64
+		used bool
+	}
+	obss := make([]obs, len(ms))
+	for i, m := range ms {
+		obss[i] = obs{a: index[m.Src], b: index[m.Dst], y: math.Log(m.Throughput), used: true}
+	}
+
+	factors := make([]float64, len(names))
+	mu := 0.0
+	residual := func(o obs) float64 {
+		return o.y - mu - factors[o.a] - factors[o.b]
+	}
+	fit := func() {
+		for iter := 0; iter < fitIterations; iter++ {
+			sum, count := 0.0, 0
+			for _, o := range obss {
+				if o.used {
+					sum += o.y - factors[o.a] - factors[o.b]
+					count++
+				}
+			}
+			mu = sum / float64(count)
+
+			change := 0.0
+			for k := range factors {
+				sum, count := 0.0, 0
+				for _, o := range obss {
+					if !o.used || (o.a != k && o.b != k) {
+						continue
+					}
+					other := o.b
+					if o.b == k {
+						other = o.a
+					}
+					sum += o.y - mu - factors[other]
+					count++
+				}
+				if count == 0 {
+					continue
+				}
+				f := sum / float64(count)
+				change = math.Max(change, math.Abs(f-factors[k]))
+				factors[k] = f
+			}
+
+			// the factors are only known up to a constant, keep them
+			// centered so that mu is the typical pair
+			mean := 0.0
+			for _, f := range factors {
+				mean += f
+			}
+			mean /= float64(len(factors))
+			for k := range factors {
+				factors[k] -= mean
+			}
+			if change < 1e-9 {
+				return
+			}
+		}
+	}
+
+	// refit without the worst link the fit cannot explain, as long as
+	// its nodes keep enough other links to be fitted from
+	degree := make([]int, len(names))
+	for _, o := range obss {
+		degree[o.a]++
+		degree[o.b]++
+	}
+	sigma := 0.0
+	for {
+		fit()
+		residuals := []float64{}
+		for _, o := range obss {
+			if o.used {
+				residuals = append(residuals, residual(o))
+			}
+		}
+		if sigma = robustStdDev(residuals); sigma == 0 {
+			break
+		}
+		worst, worstZ := -1, float64(outlierZScore)
+		for i, o := range obss {
+			if !o.used || degree[o.a] <= 2 || degree[o.b] <= 2 {
+				continue
+			}
+			if z := math.Abs(residual(o)) / sigma; z > worstZ {
+				worst, worstZ = i, z
+			}
+		}
+		if worst < 0 {
+			break
+		}
+		obss[worst].used = false
+		degree[obss[worst].a]--
+		degree[obss[worst].b]--
+	}
+
+	// compare the nodes to the typical one rather than to the mean,
+	// which the slow ones drag down. Both nodes of a pair shift, so mu
+	// takes twice the shift and the fit of every pair stays the same.
+	med := median(factors)
+	mu += 2 * med
+	for k := range factors {
+		factors[k] -= med
+	}
+
+	att := &Attribution{ResidualStdDev: sigma}
+
+	for k, name := range names {
+		n := NodeEstimate{
+			Node:     name,
+			Capacity: math.Exp(mu + factors[k]),
+			Ratio:    math.Exp(factors[k]),
+		}
+		if sigma > 0 && degree[k] > 0 {
+			n.ZScore = factors[k] / (sigma / math.Sqrt(float64(degree[k])))
+		}
+		n.Confidence = confidence(n.ZScore)
+		n.Anomalous = n.Ratio < opts.MaxRatio && n.ZScore < -opts.MinZScore
+		att.Nodes = append(att.Nodes, n)
+	}
+
+	for i, m := range ms {
+		o := obss[i]
+		r := residual(o)
+		l := LinkEstimate{
+			Src:      m.Src,
+			Dst:      m.Dst,
+			Measured: m.Throughput,
+			Expected: math.Exp(mu + factors[o.a] + factors[o.b]),
+			Ratio:    math.Exp(r),
+		}
+		if sigma > 0 {
+			l.ZScore = r / sigma
+		}
+		l.Confidence = confidence(l.ZScore)
+		l.Anomalous = l.Ratio < opts.MaxRatio && l.ZScore < -opts.MinZScore
+		att.Links = append(att.Links, l)
+	}
+
+	sort.Slice(att.Nodes, func(i, j int) bool {
+		return att.Nodes[i].Ratio < att.Nodes[j].Ratio
+	})
+	sort.Slice(att.Links, func(i, j int) bool {
+		return att.Links[i].Ratio < att.Links[j].Ratio
+	})
+	return att, nil
+}
+
+// confidence is the probability that a normal variable lies closer to
+// the mean than z standard deviations
+func confidence(z float64) float64 {
+	return math.Erf(math.Abs(z) / math.Sqrt2)
+}
+
+// robustStdDev estimates the standard deviation from the median absolute
+// deviation, which outliers barely move
+func robustStdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	return 1.4826 * median(deviations)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,168 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package analysis
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// mesh measures every ordered pair of n nodes at 1GB/s, scaled by
+// scale and by up to 3% of noise
+func mesh(n int, scale func(src, dst string) float64) []Measurement {
+	r := rand.New(rand.NewSource(1))
+	ms := []Measurement{}
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= n; j++ {
+			if i == j {
+				continue
+			}
+			src, dst := fmt.Sprintf("n%d", i), fmt.Sprintf("n%d", j)
+			t := 1e9 * scale(src, dst) * (0.97 + 0.06*r.Float64())
+			ms = append(ms, Measurement{
+				Src:        src,
+				Dst:        dst,
+				Throughput: t,
+				Latency:    1e8 / t,
+				Streams:    8,
+			})
+		}
+	}
+	return ms
+}
+
+func uniform(src, dst string) float64 {
+	return 1
+}
+
+func TestAttribute(t *testing.T) {
+	slowNode := func(src, dst string) float64 {
+		if src == "n3" || dst == "n3" {
+			return 0.5
+		}
+		return 1
+	}
+	slowLink := func(src, dst string) float64 {
+		if (src == "n1" && dst == "n5") || (src == "n5" && dst == "n1") {
+			return 0.4
+		}
+		return 1
+	}
+	testCases := []struct {
+		name  string
+		ms    []Measurement
+		nodes []string
+		links []string
+	}{
+		{
+			name: "uniform",
+			ms:   mesh(8, uniform),
+		},
+		{
+			name:  "slow node",
+			ms:    mesh(8, slowNode),
+			nodes: []string{"n3"},
+		},
+		{
+			name:  "slow link",
+			ms:    mesh(8, slowLink),
+			links: []string{"n1 -> n5", "n5 -> n1"},
+		},
+		{
+			name: "slow node and slow link",
+			ms: mesh(8, func(src, dst string) float64 {
+				return slowNode(src, dst) * slowLink(src, dst)
+			}),
+			nodes: []string{"n3"},
+			links: []string{"n1 -> n5", "n5 -> n1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att, err := Attribute(tc.ms, DefaultOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodes := []string{}
+			for _, n := range att.AnomalousNodes() {
+				nodes = append(nodes, n.Node)
+			}
+			links := []string{}
+			for _, l := range att.AnomalousLinks() {
+				links = append(links, l.Src+" -> "+l.Dst)
+			}
+			sort.Strings(links)
+			if !reflect.DeepEqual(nodes, append([]string{}, tc.nodes...)) {
+				t.Errorf("expected slow nodes %v, got %v", tc.nodes, nodes)
+			}
+			if !reflect.DeepEqual(links, append([]string{}, tc.links...)) {
+				t.Errorf("expected slow links %v, got %v", tc.links, links)
+			}
+		})
+	}
+}
+
+func TestAttributeEstimates(t *testing.T) {
+	att, err := Attribute(mesh(8, func(src, dst string) float64 {
+		if src == "n3" || dst == "n3" {
+			return 0.5
+		}
+		return 1
+	}), DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowest := att.Nodes[0]
+	if slowest.Node != "n3" || slowest.Ratio < 0.45 || slowest.Ratio > 0.55 {
+		t.Errorf("expected n3 at half the capacity, got %s at %.2f", slowest.Node, slowest.Ratio)
+	}
+	if slowest.Confidence < 0.99 {
+		t.Errorf("expected a confident estimate, got %.2f", slowest.Confidence)
+	}
+	for _, l := range att.Links {
+		if l.Ratio < 0.9 || l.Ratio > 1.1 {
+			t.Errorf("%s -> %s: expected the node to explain the link, ratio %.2f", l.Src, l.Dst, l.Ratio)
+		}
+	}
+}
+
+func TestAttributeErrors(t *testing.T) {
+	if _, err := Attribute(mesh(2, uniform), DefaultOptions); err == nil {
+		t.Error("expected an error with 2 nodes")
+	}
+	ms := mesh(4, uniform)
+	ms[0].Throughput = 0
+	if _, err := Attribute(ms, DefaultOptions); err == nil {
+		t.Error("expected an error with a zero throughput")
+	}
+}
+
+func TestRobustStdDev(t *testing.T) {
+	values := []float64{-1, 0, 1, -1, 0, 1, -1, 0, 1}
+	sigma := robustStdDev(values)
+	// an outlier barely moves it
+	if outlier := robustStdDev(append(values, 1000)); outlier != sigma {
+		t.Errorf("expected %v with an outlier, got %v", sigma, outlier)
+	}
+	if sigma := robustStdDev(nil); sigma != 0 {
+		t.Errorf("expected 0 without values, got %v", sigma)
+	}
+}
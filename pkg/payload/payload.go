@@ -0,0 +1,160 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package payload generates the data sent by the floods, from zeros to
+// incompressible random bytes, without holding it in memory.
+package payload
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Patterns of the generated data
+const (
+	// Zeros is all zero bytes, which compressing links shrink to nothing
+	Zeros = "zeros"
+	// Random is a pseudo-random, incompressible stream
+	Random = "random"
+	// Compressible mixes random and zero bytes so that the data
+	// compresses by the given ratio
+	Compressible = "compressible"
+	// File repeats the content of a sample file
+	File = "file"
+)
+
+// Patterns lists the valid patterns
+var Patterns = []string{Zeros, Random, Compressible, File}
+
+// blockSize is the granularity at which random and zero bytes are mixed,
+// small enough for the window of any compressor to see both
+const blockSize = 4096
+
+// Options select the data of a payload
+type Options struct {
+	Pattern string `json:",omitempty"`
+	// Compressibility is the fraction of each block left to zero with
+	// the Compressible pattern, e.g. 0.5 to compress by half
+	Compressibility float64 `json:",omitempty"`
+	// Sample is the data repeated by the File pattern
+	Sample []byte `json:",omitempty"`
+}
+
+// Validate checks the options
+func (o Options) Validate() error {
+	switch o.Pattern {
+	case "", Zeros, Random:
+	case Compressible:
+		if o.Compressibility < 0 || o.Compressibility >= 1 {
+			return fmt.Errorf("compressibility '%v' out of range [0, 1)", o.Compressibility)
+		}
+	case File:
+		if len(o.Sample) == 0 {
+			return fmt.Errorf("empty sample for the file pattern")
+		}
+	default:
+		return fmt.Errorf("unknown payload pattern '%s'", o.Pattern)
+	}
+	return nil
+}
+
+// Reader generates size bytes of a pattern as they are read, so that no
+// buffer of the size of the payload is held
+type Reader struct {
+	opts   Options
+	size   int64
+	offset int64
+	stream cipher.Stream
+	// random is the number of random bytes at the start of each block
+	random int
+}
+
+// NewReader returns a reader of size bytes of the pattern of opts. The
+// random bytes are the AES-CTR keystream of a key derived from seed, so
+// the same seed always reads the same data.
+func NewReader(opts Options, size int64, seed uint64) (*Reader, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Reader{
+		opts: opts,
+		size: size,
+	}
+	switch opts.Pattern {
+	case Random:
+		r.random = blockSize
+	case Compressible:
+		r.random = int(float64(blockSize) * (1 - opts.Compressibility))
+	}
+	if r.random > 0 {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], seed)
+		key := sha256.Sum256(b[:])
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		r.stream = cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	}
+	return r, nil
+}
+
+// Read fills p with the next bytes of the payload
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if rem := r.size - r.offset; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	switch r.opts.Pattern {
+	case File:
+		for n := 0; n < len(p); {
+			n += copy(p[n:], r.opts.Sample[(r.offset+int64(n))%int64(len(r.opts.Sample)):])
+		}
+	default:
+		for i := range p {
+			p[i] = 0
+		}
+		if r.random == blockSize {
+			r.stream.XORKeyStream(p, p)
+			break
+		}
+		for n := 0; n < len(p) && r.random > 0; {
+			// fill the random head of the block at offset, if any
+			pos := int((r.offset + int64(n)) % blockSize)
+			end := blockSize - pos
+			if end > len(p)-n {
+				end = len(p) - n
+			}
+			if pos < r.random {
+				head := r.random - pos
+				if head > end {
+					head = end
+				}
+				r.stream.XORKeyStream(p[n:n+head], p[n:n+head])
+			}
+			n += end
+		}
+	}
+	r.offset += int64(len(p))
+	return len(p), nil
+}
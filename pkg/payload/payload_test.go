@@ -0,0 +1,142 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package payload
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func readAll(t *testing.T, opts Options, size int64, seed uint64, wrap func(io.Reader) io.Reader) []byte {
+	t.Helper()
+	r, err := NewReader(opts, size, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(wrap(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size {
+		t.Fatalf("expected %d bytes, got %d", size, len(data))
+	}
+	return data
+}
+
+func whole(r io.Reader) io.Reader { return r }
+
+// chunked reads at sizes that cross the blocks anywhere
+func chunked(r io.Reader) io.Reader {
+	return iotest.HalfReader(iotest.OneByteReader(io.MultiReader(
+		io.LimitReader(r, 1), io.LimitReader(r, 777), io.LimitReader(r, 5000), r)))
+}
+
+func TestReaderSeed(t *testing.T) {
+	for _, opts := range []Options{
+		{Pattern: Random},
+		{Pattern: Compressible, Compressibility: 0.5},
+		{Pattern: Compressible, Compressibility: 0.3},
+	} {
+		size := int64(3*blockSize + 123)
+		a := readAll(t, opts, size, 42, whole)
+		if b := readAll(t, opts, size, 42, whole); !bytes.Equal(a, b) {
+			t.Errorf("%v: same seed read different data", opts)
+		}
+		if b := readAll(t, opts, size, 42, chunked); !bytes.Equal(a, b) {
+			t.Errorf("%v: reading in chunks read different data", opts)
+		}
+		if b := readAll(t, opts, size, 43, whole); bytes.Equal(a, b) {
+			t.Errorf("%v: different seeds read the same data", opts)
+		}
+	}
+}
+
+func TestReaderCompressible(t *testing.T) {
+	for _, c := range []float64{0, 0.25, 0.5, 0.9} {
+		opts := Options{Pattern: Compressible, Compressibility: c}
+		size := int64(256*blockSize + 1000)
+		data := readAll(t, opts, size, 1, chunked)
+
+		// each block is a random head followed by zeros
+		random := int(float64(blockSize) * (1 - c))
+		for offset := 0; offset < len(data); offset += blockSize {
+			end := offset + blockSize
+			if end > len(data) {
+				end = len(data)
+			}
+			block := data[offset:end]
+			for i := random; i < len(block); i++ {
+				if block[i] != 0 {
+					t.Fatalf("compressibility %v: byte %d of the block at %d is not zero", c, i, offset)
+				}
+			}
+		}
+
+		buf := &bytes.Buffer{}
+		w, err := flate.NewWriter(buf, flate.BestSpeed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+		ratio := float64(buf.Len()) / float64(size)
+		if expected := 1 - c; ratio < expected-0.05 || ratio > expected+0.05 {
+			t.Errorf("compressibility %v: compressed to %.2f, expected %.2f", c, ratio, expected)
+		}
+	}
+}
+
+func TestReaderPatterns(t *testing.T) {
+	size := int64(2*blockSize + 10)
+	for _, b := range readAll(t, Options{Pattern: Zeros}, size, 1, chunked) {
+		if b != 0 {
+			t.Fatal("zeros pattern read a non-zero byte")
+		}
+	}
+	for _, b := range readAll(t, Options{}, size, 1, whole) {
+		if b != 0 {
+			t.Fatal("default pattern read a non-zero byte")
+		}
+	}
+
+	sample := []byte("bottlenet sample")
+	data := readAll(t, Options{Pattern: File, Sample: sample}, size, 1, chunked)
+	for i, b := range data {
+		if b != sample[i%len(sample)] {
+			t.Fatalf("file pattern: byte %d is %q, expected %q", i, b, sample[i%len(sample)])
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	invalid := []Options{
+		{Pattern: "gibberish"},
+		{Pattern: Compressible, Compressibility: 1},
+		{Pattern: Compressible, Compressibility: -0.1},
+		{Pattern: File},
+	}
+	for _, opts := range invalid {
+		if _, err := NewReader(opts, 1, 1); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package payload
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// FrameSize is the size of a verified block, checksum included
+const FrameSize = 64 * 1024
+
+// frameTrailerSize holds the index of a block and its checksum
+const frameTrailerSize = 8
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum covers the data of a block and its index, so that reordered
+// or repeated blocks are caught as well as flipped bits
+func checksum(data []byte, index uint32) uint32 {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], index)
+	return crc32.Update(crc32.Checksum(data, castagnoli), castagnoli, b[:])
+}
+
+// frameLen is the length of the frame at offset of a stream of size
+// bytes. Frames too short to hold a trailer are left unverified.
+func frameLen(offset, size int64) int {
+	if rem := size - offset; rem < FrameSize {
+		return int(rem)
+	}
+	return FrameSize
+}
+
+// VerifiedReader splits size bytes into frames of data read from r
+// followed by the index of the frame and a CRC-32C checksum
+type VerifiedReader struct {
+	r      io.Reader
+	size   int64
+	offset int64
+	frame  []byte
+	// pending is what is left to read of the current frame
+	pending []byte
+	index   uint32
+}
+
+// NewVerifiedReader returns a reader of size bytes of checksummed frames
+func NewVerifiedReader(r io.Reader, size int64) *VerifiedReader {
+	return &VerifiedReader{
+		r:     r,
+		size:  size,
+		frame: make([]byte, FrameSize),
+	}
+}
+
+// Read fills p with the next bytes of the frames
+func (v *VerifiedReader) Read(p []byte) (int, error) {
+	if len(v.pending) == 0 {
+		if v.offset >= v.size {
+			return 0, io.EOF
+		}
+		frame := v.frame[:frameLen(v.offset, v.size)]
+		if len(frame) <= frameTrailerSize {
+			for i := range frame {
+				frame[i] = 0
+			}
+		} else {
+			data := frame[:len(frame)-frameTrailerSize]
+			if _, err := io.ReadFull(v.r, data); err != nil {
+				return 0, err
+			}
+			binary.LittleEndian.PutUint32(frame[len(data):], v.index)
+			binary.LittleEndian.PutUint32(frame[len(data)+4:], checksum(data, v.index))
+		}
+		v.index++
+		v.offset += int64(len(frame))
+		v.pending = frame
+	}
+	n := copy(p, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+// Verification counts the blocks checked by Verify
+type Verification struct {
+	Blocks    int64
+	Corrupted int64
+	// FirstCorrupted is the offset of the first corrupted block, -1 if
+	// none is
+	FirstCorrupted int64
+}
+
+// Verify reads size bytes of frames written by a VerifiedReader from r
+// and checks each of them
+func Verify(r io.Reader, size int64) (Verification, error) {
+	res := Verification{FirstCorrupted: -1}
+	frame := make([]byte, FrameSize)
+	for offset := int64(0); offset < size; {
+		n := frameLen(offset, size)
+		if _, err := io.ReadFull(r, frame[:n]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return res, err
+		}
+		if n > frameTrailerSize {
+			data := frame[:n-frameTrailerSize]
+			index := uint32(offset / FrameSize)
+			res.Blocks++
+			if binary.LittleEndian.Uint32(frame[len(data):]) != index ||
+				binary.LittleEndian.Uint32(frame[len(data)+4:]) != checksum(data, index) {
+				res.Corrupted++
+				if res.FirstCorrupted < 0 {
+					res.FirstCorrupted = offset
+				}
+			}
+		}
+		offset += int64(n)
+	}
+	return res, nil
+}
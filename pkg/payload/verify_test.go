@@ -0,0 +1,155 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package payload
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// verifiedPayload reads size bytes of checksummed frames of random data
+func verifiedPayload(t *testing.T, size int64) []byte {
+	t.Helper()
+	r, err := NewReader(Options{Pattern: Random}, size, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(iotest.HalfReader(NewVerifiedReader(r, size)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size {
+		t.Fatalf("expected %d bytes, got %d", size, len(data))
+	}
+	return data
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	testCases := []struct {
+		size   int64
+		blocks int64
+	}{
+		{size: 0, blocks: 0},
+		{size: frameTrailerSize, blocks: 0},
+		{size: frameTrailerSize + 1, blocks: 1},
+		{size: FrameSize - 1, blocks: 1},
+		{size: FrameSize, blocks: 1},
+		// a trailing frame too short for a trailer is not verified
+		{size: FrameSize + 1, blocks: 1},
+		{size: FrameSize + frameTrailerSize, blocks: 1},
+		{size: FrameSize + frameTrailerSize + 1, blocks: 2},
+		{size: 3*FrameSize + 1000, blocks: 4},
+	}
+	for _, tc := range testCases {
+		data := verifiedPayload(t, tc.size)
+		res, err := Verify(iotest.OneByteReader(bytes.NewReader(data)), tc.size)
+		if err != nil {
+			t.Fatalf("size %d: %v", tc.size, err)
+		}
+		if res.Blocks != tc.blocks || res.Corrupted != 0 || res.FirstCorrupted != -1 {
+			t.Errorf("size %d: expected %d clean blocks, got %+v", tc.size, tc.blocks, res)
+		}
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	size := int64(4*FrameSize + 100)
+	testCases := []struct {
+		name      string
+		corrupt   func(data []byte)
+		corrupted int64
+		first     int64
+	}{
+		{
+			name:      "data bit",
+			corrupt:   func(data []byte) { data[2*FrameSize+10] ^= 1 },
+			corrupted: 1,
+			first:     2 * FrameSize,
+		},
+		{
+			name:      "checksum bit",
+			corrupt:   func(data []byte) { data[FrameSize-1] ^= 0x80 },
+			corrupted: 1,
+			first:     0,
+		},
+		{
+			name:      "last frame",
+			corrupt:   func(data []byte) { data[size-1] ^= 1 },
+			corrupted: 1,
+			first:     4 * FrameSize,
+		},
+		{
+			name: "swapped frames",
+			corrupt: func(data []byte) {
+				first := append([]byte{}, data[FrameSize:2*FrameSize]...)
+				copy(data[FrameSize:], data[3*FrameSize:4*FrameSize])
+				copy(data[3*FrameSize:], first)
+			},
+			corrupted: 2,
+			first:     FrameSize,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := verifiedPayload(t, size)
+			tc.corrupt(data)
+			res, err := Verify(bytes.NewReader(data), size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Blocks != 5 {
+				t.Errorf("expected 5 blocks, got %d", res.Blocks)
+			}
+			if res.Corrupted != tc.corrupted || res.FirstCorrupted != tc.first {
+				t.Errorf("expected %d corrupted from %d, got %d from %d",
+					tc.corrupted, tc.first, res.Corrupted, res.FirstCorrupted)
+			}
+		})
+	}
+}
+
+func TestVerifyShortTrailingFrame(t *testing.T) {
+	// the last frame of 8 bytes or less carries no checksum, its bytes
+	// are zeros and a flipped bit goes unnoticed
+	size := int64(FrameSize + frameTrailerSize)
+	data := verifiedPayload(t, size)
+	if !bytes.Equal(data[FrameSize:], make([]byte, frameTrailerSize)) {
+		t.Errorf("expected a zero trailing frame, got %v", data[FrameSize:])
+	}
+	data[size-1] ^= 1
+	res, err := Verify(bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Blocks != 1 || res.Corrupted != 0 {
+		t.Errorf("expected 1 clean block, got %+v", res)
+	}
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	size := int64(2 * FrameSize)
+	data := verifiedPayload(t, size)
+	for _, n := range []int{0, FrameSize, FrameSize + 100} {
+		if _, err := Verify(bytes.NewReader(data[:n]), size); err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d: expected %v, got %v", n, io.ErrUnexpectedEOF, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package perf
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultRelativeError is the relative error of a Histogram recorded
+// into before its error was set
+const DefaultRelativeError = 0.01
+
+// minHistogramValue is the smallest value told apart from zero
+const minHistogramValue = 1e-9
+
+// Histogram counts values in logarithmic buckets, so that percentiles
+// are accurate to within a fixed relative error whatever the range of
+// the values, in the spirit of HDR histograms. Histograms with the same
+// relative error can be merged without losing accuracy, to combine
+// streams, nodes or rounds. The zero value is ready to use.
+type Histogram struct {
+	RelativeError float64 `json:"relative_error"`
+	// Offset is the bucket index of Counts[0]
+	Offset int      `json:"offset"`
+	Counts []uint64 `json:"counts"`
+	// ZeroCount counts the values too small for a bucket
+	ZeroCount  uint64  `json:"zero_count"`
+	Count      uint64  `json:"count"`
+	Sum        float64 `json:"sum"`
+	SumSquares float64 `json:"sum_squares"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+}
+
+// NewHistogram returns an empty histogram whose percentiles are within
+// relativeError of the recorded values, e.g. 0.01 for 1%
+func NewHistogram(relativeError float64) *Histogram {
+	return &Histogram{RelativeError: relativeError}
+}
+
+// gamma is the ratio between the bounds of a bucket
+func (h *Histogram) gamma() float64 {
+	return (1 + h.RelativeError) / (1 - h.RelativeError)
+}
+
+func (h *Histogram) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(h.gamma())))
+}
+
+// value is the estimate of the values in bucket i, within the relative
+// error of both of its bounds
+func (h *Histogram) value(i int) float64 {
+	g := h.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Record adds v to the histogram
+func (h *Histogram) Record(v float64) {
+	if h.RelativeError == 0 {
+		h.RelativeError = DefaultRelativeError
+	}
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if h.Count == 0 || v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+	h.SumSquares += v * v
+
+	if v < minHistogramValue {
+		h.ZeroCount++
+		return
+	}
+	h.add(h.index(v), 1)
+}
+
+// add counts n values in bucket i, growing Counts as needed
+func (h *Histogram) add(i int, n uint64) {
+	if len(h.Counts) == 0 {
+		h.Offset = i
+	}
+	if i < h.Offset {
+		grown := make([]uint64, h.Offset-i+len(h.Counts))
+		copy(grown[h.Offset-i:], h.Counts)
+		h.Counts, h.Offset = grown, i
+	}
+	if i >= h.Offset+len(h.Counts) {
+		h.Counts = append(h.Counts, make([]uint64, i-h.Offset-len(h.Counts)+1)...)
+	}
+	h.Counts[i-h.Offset] += n
+}
+
+// Merge adds the values of o to the histogram. Both must have the same
+// relative error.
+func (h *Histogram) Merge(o *Histogram) error {
+	if o.Count == 0 {
+		return nil
+	}
+	if h.Count == 0 && h.RelativeError == 0 {
+		h.RelativeError = o.RelativeError
+	}
+	if h.RelativeError != o.RelativeError {
+		return fmt.Errorf("cannot merge histograms with relative errors %v and %v", h.RelativeError, o.RelativeError)
+	}
+	if h.Count == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	if h.Count == 0 || o.Max > h.Max {
+		h.Max = o.Max
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+	h.SumSquares += o.SumSquares
+	h.ZeroCount += o.ZeroCount
+	for i, n := range o.Counts {
+		if n > 0 {
+			h.add(o.Offset+i, n)
+		}
+	}
+	return nil
+}
+
+// Percentile returns the p-th percentile, 0 < p <= 100, of the recorded
+// values
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := h.ZeroCount
+	if seen >= rank {
+		return h.Min
+	}
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank {
+			return math.Min(math.Max(h.value(h.Offset+i), h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
+
+// summary computes the statistics of the recorded values
+func (h *Histogram) summary(percentiles []float64) summary {
+	s := summary{
+		p50:         h.Percentile(50),
+		p90:         h.Percentile(90),
+		p99:         h.Percentile(99),
+		p999:        h.Percentile(99.9),
+		min:         h.Min,
+		max:         h.Max,
+		count:       int(h.Count),
+		percentiles: map[string]float64{},
+	}
+	if h.Count > 0 {
+		s.avg = h.Sum / float64(h.Count)
+	}
+	if h.Count > 1 {
+		n := float64(h.Count)
+		variance := (h.SumSquares - n*s.avg*s.avg) / (n - 1)
+		s.stdDev = math.Sqrt(math.Max(variance, 0))
+	}
+	s.setSpread()
+	for _, p := range percentiles {
+		s.percentiles[PercentileKey(p)] = h.Percentile(p)
+	}
+	return s
+}
+
+// Latency summarizes the histogram as latencies in seconds
+func (h *Histogram) Latency(percentiles ...float64) Latency {
+	return h.summary(percentiles).latency()
+}
+
+// Throughput summarizes the histogram as throughputs in bytes per second
+func (h *Histogram) Throughput(percentiles ...float64) Throughput {
+	return h.summary(percentiles).throughput()
+}
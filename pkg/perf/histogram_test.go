@@ -0,0 +1,193 @@
+/*
+ * Bottlenet (C) 2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package perf
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// exactPercentile is the value of rank ceil(p/100*n) of sorted values
+func exactPercentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func checkPercentiles(t *testing.T, h *Histogram, values []float64) {
+	t.Helper()
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	for _, p := range []float64{1, 10, 25, 50, 75, 90, 99, 99.9, 100} {
+		expected := exactPercentile(sorted, p)
+		got := h.Percentile(p)
+		if math.Abs(got-expected) > h.RelativeError*expected+1e-12 {
+			t.Errorf("p%v: expected %v within %v, got %v", p, expected, h.RelativeError, got)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	testCases := []struct {
+		name          string
+		relativeError float64
+		value         func() float64
+	}{
+		{"uniform latencies", 0.01, func() float64 { return 0.001 + r.Float64() }},
+		{"exponential latencies", 0.01, func() float64 { return r.ExpFloat64() / 10 }},
+		{"throughputs over decades", 0.02, func() float64 { return math.Pow(10, 6+4*r.Float64()) }},
+		{"single value", 0.01, func() float64 { return 42 }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHistogram(tc.relativeError)
+			values := []float64{}
+			for i := 0; i < 10000; i++ {
+				v := tc.value()
+				values = append(values, v)
+				h.Record(v)
+			}
+			if h.Count != uint64(len(values)) {
+				t.Fatalf("expected %d values, got %d", len(values), h.Count)
+			}
+			checkPercentiles(t, h, values)
+		})
+	}
+}
+
+func TestHistogramDefaultRelativeError(t *testing.T) {
+	h := Histogram{}
+	h.Record(1)
+	if h.RelativeError != DefaultRelativeError {
+		t.Errorf("expected relative error %v, got %v", DefaultRelativeError, h.RelativeError)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	// the high values are recorded first, so that merging the low ones
+	// grows the counts below their offset
+	high, low := NewHistogram(0.01), NewHistogram(0.01)
+	values := []float64{}
+	for i := 0; i < 1000; i++ {
+		v := 100 + float64(i)
+		high.Record(v)
+		values = append(values, v)
+	}
+	for i := 0; i < 500; i++ {
+		v := 0.001 * float64(i+1)
+		low.Record(v)
+		values = append(values, v)
+	}
+
+	merged := NewHistogram(0.01)
+	if err := merged.Merge(high); err != nil {
+		t.Fatal(err)
+	}
+	offset := merged.Offset
+	if err := merged.Merge(low); err != nil {
+		t.Fatal(err)
+	}
+	if merged.Offset >= offset {
+		t.Errorf("expected the offset to grow below %d, got %d", offset, merged.Offset)
+	}
+	if merged.Count != 1500 {
+		t.Errorf("expected 1500 values, got %d", merged.Count)
+	}
+	if merged.Min != low.Min || merged.Max != high.Max {
+		t.Errorf("expected range [%v, %v], got [%v, %v]", low.Min, high.Max, merged.Min, merged.Max)
+	}
+	if sum := high.Sum + low.Sum; math.Abs(merged.Sum-sum) > 1e-9*sum {
+		t.Errorf("expected sum %v, got %v", sum, merged.Sum)
+	}
+	checkPercentiles(t, merged, values)
+
+	// merging is the same as recording everything in one histogram
+	recorded := NewHistogram(0.01)
+	for _, v := range values {
+		recorded.Record(v)
+	}
+	for _, p := range []float64{50, 90, 99} {
+		if merged.Percentile(p) != recorded.Percentile(p) {
+			t.Errorf("p%v: merged %v, recorded %v", p, merged.Percentile(p), recorded.Percentile(p))
+		}
+	}
+
+	// an empty histogram merges into anything
+	if err := merged.Merge(NewHistogram(0.05)); err != nil {
+		t.Errorf("merging an empty histogram: %v", err)
+	}
+}
+
+func TestHistogramMergeRelativeError(t *testing.T) {
+	a, b := NewHistogram(0.01), NewHistogram(0.02)
+	a.Record(1)
+	b.Record(2)
+	if err := a.Merge(b); err == nil {
+		t.Fatal("expected an error merging histograms with different relative errors")
+	}
+	if a.Count != 1 {
+		t.Errorf("failed merge changed the histogram, count %d", a.Count)
+	}
+
+	// a zero histogram takes the relative error of the first merged one
+	z := Histogram{}
+	if err := z.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if z.RelativeError != 0.02 {
+		t.Errorf("expected relative error 0.02, got %v", z.RelativeError)
+	}
+}
+
+func TestHistogramZeroCount(t *testing.T) {
+	h := NewHistogram(0.01)
+	for _, v := range []float64{0, 0, minHistogramValue / 2, 1, 2, 3} {
+		h.Record(v)
+	}
+	if h.ZeroCount != 3 {
+		t.Errorf("expected 3 values counted as zero, got %d", h.ZeroCount)
+	}
+	if h.Min != 0 {
+		t.Errorf("expected min 0, got %v", h.Min)
+	}
+	if p := h.Percentile(50); p != 0 {
+		t.Errorf("expected p50 0, got %v", p)
+	}
+	if p := h.Percentile(100); math.Abs(p-3) > 0.01*3 {
+		t.Errorf("expected p100 3, got %v", p)
+	}
+
+	o := NewHistogram(0.01)
+	o.Record(0)
+	if err := h.Merge(o); err != nil {
+		t.Fatal(err)
+	}
+	if h.ZeroCount != 4 {
+		t.Errorf("expected 4 values counted as zero after merge, got %d", h.ZeroCount)
+	}
+
+	empty := NewHistogram(0.01)
+	if p := empty.Percentile(99); p != 0 {
+		t.Errorf("expected p99 of an empty histogram 0, got %v", p)
+	}
+}
@@ -18,108 +18,269 @@
 package perf
 
 import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/montanaflynn/stats"
 )
 
 // Perf holds latency and throughput information for a particular node
 type Perf struct {
-	Latency    Latency
+	Latency Latency
+	// Throughput is the aggregate throughput of all streams
 	Throughput Throughput
+	// StreamThroughput is the throughput of a single stream
+	StreamThroughput Throughput
+	// Streams is the number of concurrent streams
+	Streams int
+	// Series is the aggregate throughput over the course of the test
+	Series Series
+	// Histograms hold the samples of the test in mergeable form
+	Histograms Histograms
+	// Integrity is set if the receiver verified the data
+	Integrity *Integrity `json:",omitempty"`
+	// Receiver is what the receiver measured on its side
+	Receiver *Receiver `json:",omitempty"`
+	// Sent is what the sender sent, on the sender's clock
+	Sent *Transfer `json:",omitempty"`
+}
+
+// Transfer counts the bytes of a test and when they were sent
+type Transfer struct {
+	Bytes int64     `json:"bytes"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Receiver holds the receiver's view of a test, to reconcile with the
+// sender's
+type Receiver struct {
+	// Bytes is the number of bytes received in accepted requests
+	Bytes int64 `json:"bytes"`
+	// Goodput is Bytes over the time from the first to the last byte
+	// received, on the receiver's clock
+	Goodput   float64   `json:"goodput_bytes_per_sec"`
+	FirstByte time.Time `json:"first_byte"`
+	LastByte  time.Time `json:"last_byte"`
+	// Rejected counts the requests the sender completed but the
+	// receiver failed or cut short, which are left out of the test
+	Rejected int `json:"rejected"`
+	// TimedOut counts the requests that did not complete in time,
+	// which are left out of the test as well
+	TimedOut  int    `json:"timed_out"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Integrity counts the blocks the receiver of a test verified
+type Integrity struct {
+	Blocks    int64 `json:"blocks"`
+	Corrupted int64 `json:"corrupted"`
+	// CorruptedRequests is the number of requests with corrupted blocks
+	CorruptedRequests int `json:"corrupted_requests"`
+}
+
+// Histograms hold the latencies and throughputs of a test, to be merged
+// across pairs
+type Histograms struct {
+	Latency          Histogram
+	Throughput       Histogram
+	StreamThroughput Histogram
+}
+
+// Series holds throughput sampled at a fixed interval, showing ramp-up,
+// stalls and throttling that the percentiles hide
+type Series struct {
+	Interval float64   `json:"interval_secs"`
+	Samples  []float64 `json:"bytes_per_sec"`
 }
 
 // Latency holds latency information for read/write operations to the drive
 type Latency struct {
-	Avg          float64 `json:"avg_secs,omitempty"`
-	Percentile50 float64 `json:"percentile50_secs,omitempty"`
-	Percentile90 float64 `json:"percentile90_secs,omitempty"`
-	Percentile99 float64 `json:"percentile99_secs,omitempty"`
-	Min          float64 `json:"min_secs,omitempty"`
-	Max          float64 `json:"max_secs,omitempty"`
+	Avg           float64 `json:"avg_secs"`
+	Percentile50  float64 `json:"percentile50_secs"`
+	Percentile90  float64 `json:"percentile90_secs"`
+	Percentile99  float64 `json:"percentile99_secs"`
+	Percentile999 float64 `json:"percentile999_secs"`
+	Min           float64 `json:"min_secs"`
+	Max           float64 `json:"max_secs"`
+	StdDev        float64 `json:"stddev_secs"`
+	// CV is the coefficient of variation, StdDev relative to Avg
+	CV float64 `json:"cv"`
+	// CI95Low and CI95High bound the 95% confidence interval of Avg
+	CI95Low  float64 `json:"ci95_low_secs"`
+	CI95High float64 `json:"ci95_high_secs"`
+	Count    int     `json:"count"`
+	// Percentiles holds the extra percentiles asked for, keyed by
+	// percentile, e.g. "99.5"
+	Percentiles map[string]float64 `json:"percentiles_secs"`
 }
 
 // Throughput holds throughput information for read/write operations to the drive
 type Throughput struct {
-	Avg          float64 `json:"avg_bytes_per_sec,omitempty"`
-	Percentile50 float64 `json:"percentile50_bytes_per_sec,omitempty"`
-	Percentile90 float64 `json:"percentile90_bytes_per_sec,omitempty"`
-	Percentile99 float64 `json:"percentile99_bytes_per_sec,omitempty"`
-	Min          float64 `json:"min_bytes_per_sec,omitempty"`
-	Max          float64 `json:"max_bytes_per_sec,omitempty"`
-}
-
-// ComputePerf takes arrays of Latency & Throughput to compute Statistics
-func ComputePerf(latencies, throughputs []float64) (Perf, error) {
-	var avgLatency float64
-	var percentile50Latency float64
-	var percentile90Latency float64
-	var percentile99Latency float64
-	var minLatency float64
-	var maxLatency float64
-
-	var avgThroughput float64
-	var percentile50Throughput float64
-	var percentile90Throughput float64
-	var percentile99Throughput float64
-	var minThroughput float64
-	var maxThroughput float64
-	var err error
-
-	if avgLatency, err = stats.Mean(latencies); err != nil {
-		return Perf{}, err
+	Avg           float64 `json:"avg_bytes_per_sec"`
+	Percentile50  float64 `json:"percentile50_bytes_per_sec"`
+	Percentile90  float64 `json:"percentile90_bytes_per_sec"`
+	Percentile99  float64 `json:"percentile99_bytes_per_sec"`
+	Percentile999 float64 `json:"percentile999_bytes_per_sec"`
+	Min           float64 `json:"min_bytes_per_sec"`
+	Max           float64 `json:"max_bytes_per_sec"`
+	StdDev        float64 `json:"stddev_bytes_per_sec"`
+	// CV is the coefficient of variation, StdDev relative to Avg
+	CV float64 `json:"cv"`
+	// CI95Low and CI95High bound the 95% confidence interval of Avg
+	CI95Low  float64 `json:"ci95_low_bytes_per_sec"`
+	CI95High float64 `json:"ci95_high_bytes_per_sec"`
+	Count    int     `json:"count"`
+	// Percentiles holds the extra percentiles asked for, keyed by
+	// percentile, e.g. "99.5"
+	Percentiles map[string]float64 `json:"percentiles_bytes_per_sec"`
+}
+
+// summary holds the statistics shared by latency and throughput
+type summary struct {
+	avg, p50, p90, p99, p999 float64
+	min, max                 float64
+	stdDev, cv               float64
+	ciLow, ciHigh            float64
+	count                    int
+	percentiles              map[string]float64
+}
+
+// tDist95 holds the two-sided 95% quantiles of Student's t distribution
+// for 1 to 30 degrees of freedom
+var tDist95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// PercentileKey formats a percentile as used in the Percentiles maps
+func PercentileKey(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// percentile is stats.Percentile, falling back to the minimum when there
+// are too few samples to interpolate a low percentile
+func percentile(input []float64, p float64) (float64, error) {
+	v, err := stats.Percentile(input, p)
+	if err == stats.BoundsErr && p > 0 && p <= 100 {
+		return stats.Min(input)
 	}
-	if percentile50Latency, err = stats.Percentile(latencies, 50); err != nil {
-		return Perf{}, err
+	return v, err
+}
+
+// setSpread derives the coefficient of variation and the confidence
+// interval of the mean from avg, stdDev and count
+func (s *summary) setSpread() {
+	s.ciLow, s.ciHigh = s.avg, s.avg
+	if s.count > 1 {
+		t := 1.96
+		if df := s.count - 1; df <= len(tDist95) {
+			t = tDist95[df-1]
+		}
+		margin := t * s.stdDev / math.Sqrt(float64(s.count))
+		s.ciLow, s.ciHigh = s.avg-margin, s.avg+margin
 	}
-	if percentile90Latency, err = stats.Percentile(latencies, 90); err != nil {
-		return Perf{}, err
+	if s.avg != 0 {
+		s.cv = s.stdDev / s.avg
 	}
-	if percentile99Latency, err = stats.Percentile(latencies, 99); err != nil {
-		return Perf{}, err
+}
+
+func (s summary) latency() Latency {
+	return Latency{
+		Avg:           s.avg,
+		Percentile50:  s.p50,
+		Percentile90:  s.p90,
+		Percentile99:  s.p99,
+		Percentile999: s.p999,
+		Min:           s.min,
+		Max:           s.max,
+		StdDev:        s.stdDev,
+		CV:            s.cv,
+		CI95Low:       s.ciLow,
+		CI95High:      s.ciHigh,
+		Count:         s.count,
+		Percentiles:   s.percentiles,
 	}
-	if maxLatency, err = stats.Max(latencies); err != nil {
-		return Perf{}, err
+}
+
+func (s summary) throughput() Throughput {
+	return Throughput{
+		Avg:           s.avg,
+		Percentile50:  s.p50,
+		Percentile90:  s.p90,
+		Percentile99:  s.p99,
+		Percentile999: s.p999,
+		Min:           s.min,
+		Max:           s.max,
+		StdDev:        s.stdDev,
+		CV:            s.cv,
+		CI95Low:       s.ciLow,
+		CI95High:      s.ciHigh,
+		Count:         s.count,
+		Percentiles:   s.percentiles,
 	}
-	if minLatency, err = stats.Min(latencies); err != nil {
-		return Perf{}, err
+}
+
+func summarize(input []float64, percentiles []float64) (s summary, err error) {
+	if s.avg, err = stats.Mean(input); err != nil {
+		return s, err
 	}
-	l := Latency{
-		Avg:          avgLatency,
-		Percentile50: percentile50Latency,
-		Percentile90: percentile90Latency,
-		Percentile99: percentile99Latency,
-		Min:          minLatency,
-		Max:          maxLatency,
+	if s.p50, err = percentile(input, 50); err != nil {
+		return s, err
 	}
-
-	if avgThroughput, err = stats.Mean(throughputs); err != nil {
-		return Perf{}, err
+	if s.p90, err = percentile(input, 90); err != nil {
+		return s, err
 	}
-	if percentile50Throughput, err = stats.Percentile(throughputs, 50); err != nil {
-		return Perf{}, err
+	if s.p99, err = percentile(input, 99); err != nil {
+		return s, err
 	}
-	if percentile90Throughput, err = stats.Percentile(throughputs, 90); err != nil {
-		return Perf{}, err
+	if s.p999, err = percentile(input, 99.9); err != nil {
+		return s, err
 	}
-	if percentile99Throughput, err = stats.Percentile(throughputs, 99); err != nil {
-		return Perf{}, err
+	if s.max, err = stats.Max(input); err != nil {
+		return s, err
 	}
-	if maxThroughput, err = stats.Max(throughputs); err != nil {
-		return Perf{}, err
+	if s.min, err = stats.Min(input); err != nil {
+		return s, err
 	}
-	if minThroughput, err = stats.Min(throughputs); err != nil {
-		return Perf{}, err
+
+	s.count = len(input)
+	if s.count > 1 {
+		if s.stdDev, err = stats.StandardDeviationSample(input); err != nil {
+			return s, err
+		}
 	}
-	t := Throughput{
-		Avg:          avgThroughput,
-		Percentile50: percentile50Throughput,
-		Percentile90: percentile90Throughput,
-		Percentile99: percentile99Throughput,
-		Min:          minThroughput,
-		Max:          maxThroughput,
+	s.setSpread()
+
+	s.percentiles = map[string]float64{}
+	percentiles = append([]float64{}, percentiles...)
+	sort.Float64s(percentiles)
+	for _, p := range percentiles {
+		v, err := percentile(input, p)
+		if err != nil {
+			return s, err
+		}
+		s.percentiles[PercentileKey(p)] = v
 	}
+	return s, nil
+}
 
+// ComputePerf takes arrays of Latency & Throughput to compute Statistics.
+// percentiles are computed in addition to the fixed ones.
+func ComputePerf(latencies, throughputs []float64, percentiles ...float64) (Perf, error) {
+	ls, err := summarize(latencies, percentiles)
+	if err != nil {
+		return Perf{}, err
+	}
+	ts, err := summarize(throughputs, percentiles)
+	if err != nil {
+		return Perf{}, err
+	}
 	return Perf{
-		Latency:    l,
-		Throughput: t,
+		Latency:    ls.latency(),
+		Throughput: ts.throughput(),
 	}, nil
 }